@@ -2,4 +2,4 @@ module link
 
 go 1.19
 
-require golang.org/x/net v0.0.0-20220909164309-bea034e7d591 // indirect
+require golang.org/x/net v0.0.0-20220909164309-bea034e7d591
@@ -0,0 +1,263 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "strings"
+)
+
+// questionKind is how a problem is asked and graded.
+type questionKind int
+
+const (
+    freeText     questionKind = iota // typed answer, graded by the match rule
+    singleChoice                     // pick one labeled option
+    trueFalse                        // a single choice between True and False
+    multiSelect                      // pick every correct option
+    multiPart                        // several typed parts, each graded by the match rule
+)
+
+var kindNames = map[string]questionKind{
+    "":                freeText,
+    "free":            freeText,
+    "text":            freeText,
+    "choice":          singleChoice,
+    "multiple-choice": singleChoice,
+    "tf":              trueFalse,
+    "true/false":      trueFalse,
+    "truefalse":       trueFalse,
+    "multi":           multiSelect,
+    "multi-select":    multiSelect,
+    "parts":           multiPart,
+    "multi-part":      multiPart,
+}
+
+func (k questionKind) String() string {
+    switch k {
+    case singleChoice:
+        return "choice"
+    case trueFalse:
+        return "tf"
+    case multiSelect:
+        return "multi"
+    case multiPart:
+        return "parts"
+    default:
+        return "free"
+    }
+}
+
+var trueFalseOptions = []string{"True", "False"}
+
+// words accepted for true/false besides the labels and option text
+var trueFalseWords = map[string]string{
+    "t":   "True",
+    "yes": "True",
+    "y":   "True",
+    "f":   "False",
+    "no":  "False",
+    "n":   "False",
+}
+
+// choice reports whether questions of kind k are answered by picking
+// options.
+func (k questionKind) choice() bool {
+    return k == singleChoice || k == trueFalse || k == multiSelect
+}
+
+// label is the letter shown next to option i.
+func label(i int) string {
+    return string(rune('A' + i))
+}
+
+// option returns the index of the option s refers to, either by label or
+// by its text, and -1 if it doesn't refer to any. Labels come first, so
+// "B" is option B even when another option reads "b".
+func (p Problem) option(s string) int {
+    s = strings.TrimSpace(s)
+    if p.kind == trueFalse {
+        if w, ok := trueFalseWords[strings.ToLower(s)]; ok {
+            s = w
+        }
+    }
+    for i := range p.options {
+        if strings.EqualFold(s, label(i)) {
+            return i
+        }
+    }
+    for i, o := range p.options {
+        if strings.EqualFold(s, o) {
+            return i
+        }
+    }
+    return -1
+}
+
+// picks turns a user's answer into the set of options it selects. Multi
+// select answers may be separated by commas or spaces ("A, C" or "A C")
+// or run together as labels ("AC"). ok is false if any part of the answer
+// isn't an option.
+func (p Problem) picks(given string) (picked map[int]bool, ok bool) {
+    picked = make(map[int]bool)
+    if p.kind != multiSelect {
+        i := p.option(given)
+        if i < 0 {
+            return picked, false
+        }
+        picked[i] = true
+        return picked, true
+    }
+    parts := strings.FieldsFunc(given, func(r rune) bool {
+        return r == ',' || r == ' ' || r == '\t'
+    })
+    for _, part := range parts {
+        if i := p.option(part); i >= 0 {
+            picked[i] = true
+            continue
+        }
+        // run together labels
+        for _, r := range part {
+            i := p.option(string(r))
+            if i < 0 {
+                return picked, false
+            }
+            picked[i] = true
+        }
+    }
+    return picked, len(picked) > 0
+}
+
+// correctOptions is the set of options that are right answers. The
+// answers hold option text (see setChoices), which may look like a label
+// once the options are shuffled, so only the text is compared.
+func (p Problem) correctOptions() map[int]bool {
+    correct := make(map[int]bool)
+    for _, a := range p.answers {
+        for i, o := range p.options {
+            if o == a {
+                correct[i] = true
+            }
+        }
+    }
+    return correct
+}
+
+// acceptsChoice grades a choice problem: the picks have to be exactly
+// the correct options.
+func (p Problem) acceptsChoice(given string) bool {
+    picked, ok := p.picks(given)
+    if !ok {
+        return false
+    }
+    correct := p.correctOptions()
+    if len(picked) != len(correct) {
+        return false
+    }
+    for i := range picked {
+        if !correct[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// setChoices validates the options and answers of a choice problem and
+// rewrites the answers from labels to option text, so they still hold
+// after the options are shuffled.
+func (p *Problem) setChoices(options []string) error {
+    if p.kind == trueFalse {
+        if len(options) > 0 {
+            return fmt.Errorf("true/false questions can't have options")
+        }
+        options = trueFalseOptions
+    }
+    if len(options) < 2 {
+        return fmt.Errorf("%s questions need at least 2 options", p.kind)
+    }
+    if len(options) > 26 {
+        return fmt.Errorf("too many options, at most 26 can be labeled")
+    }
+    p.options = options
+    answers := make([]string, 0, len(p.answers))
+    for _, a := range p.answers {
+        // a multi select answer may be written like a user's answer, "A,C"
+        picked, ok := p.picks(a)
+        if p.kind != multiSelect || !ok {
+            i := p.option(a)
+            if i < 0 {
+                return fmt.Errorf("answer %q is not one of the options", a)
+            }
+            picked = map[int]bool{i: true}
+        }
+        for i := range options {
+            if picked[i] {
+                answers = append(answers, options[i])
+            }
+        }
+    }
+    if p.kind != multiSelect && len(answers) != 1 {
+        return fmt.Errorf("%s questions need exactly one answer", p.kind)
+    }
+    p.answers = answers
+    return nil
+}
+
+// shuffleOptions returns a copy of the problems with the options of every
+// choice and multi select problem in random order.
+func shuffleOptions(problems []Problem, rng *rand.Rand) []Problem {
+    ps := make([]Problem, len(problems))
+    copy(ps, problems)
+    for i := range ps {
+        if ps[i].kind != singleChoice && ps[i].kind != multiSelect {
+            continue
+        }
+        options := make([]string, len(ps[i].options))
+        copy(options, ps[i].options)
+        rng.Shuffle(len(options), func(a, b int) {
+            options[a], options[b] = options[b], options[a]
+        })
+        ps[i].options = options
+    }
+    return ps
+}
+
+// prompt is the question as shown in the terminal, with its options
+// listed underneath and a hint of how to answer.
+func (p Problem) prompt() string {
+    if p.kind == multiPart {
+        return fmt.Sprintf("%s\n(%d parts, separated by commas)", p.q, len(p.answers))
+    }
+    if !p.kind.choice() {
+        return p.q
+    }
+    var b strings.Builder
+    b.WriteString(p.q)
+    for i, o := range p.options {
+        fmt.Fprintf(&b, "\n    %s) %s", label(i), o)
+    }
+    last := label(len(p.options) - 1)
+    if p.kind == multiSelect {
+        fmt.Fprintf(&b, "\n(pick all that apply, e.g. A,%s)", last)
+    } else {
+        fmt.Fprintf(&b, "\n(A-%s)", last)
+    }
+    return b.String()
+}
+
+// solution is the right answer as shown once a question is over.
+func (p Problem) solution() string {
+    if p.kind == multiPart {
+        return strings.Join(p.answers, ", ")
+    }
+    if !p.kind.choice() {
+        return p.answers[0]
+    }
+    correct := p.correctOptions()
+    shown := make([]string, 0, len(correct))
+    for i, o := range p.options {
+        if correct[i] {
+            shown = append(shown, fmt.Sprintf("%s) %s", label(i), o))
+        }
+    }
+    return strings.Join(shown, ", ")
+}
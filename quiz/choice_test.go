@@ -0,0 +1,113 @@
+package main
+
+import (
+    "math/rand"
+    "strings"
+    "testing"
+)
+
+const choiceProblems = `
+- question: Capital of France
+  options: [Berlin, Paris, Rome]
+  answer: B
+- question: Go has generics
+  type: tf
+  answer: "true"
+- question: Pick the primes
+  options: [2, 4, 5, 9]
+  answer: A,C
+- question: Pick the vowels
+  type: multi
+  options: [a, b, e]
+  answer: [a, e]
+`
+
+func TestChoiceGrading(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", choiceProblems)
+    tests := []struct {
+        problem int
+        given   string
+        credit  float64
+    }{
+        {0, "B", 1},
+        {0, "b", 1},
+        {0, "paris", 1},
+        {0, " B ", 1},
+        {0, "A", 0},
+        {0, "D", 0},
+        {0, "B,C", 0},
+        {1, "A", 1},
+        {1, "true", 1},
+        {1, "y", 1},
+        {1, "yes", 1},
+        {1, "no", 0},
+        {1, "F", 0},
+        {1, "maybe", 0},
+        {2, "A,C", 1},
+        {2, "C, A", 1},
+        {2, "a c", 1},
+        {2, "AC", 1},
+        {2, "2, 5", 1},
+        {2, "A", 0.5},
+        {2, "A,B", 0},
+        {2, "A,B,C", 0.5},
+        {2, "ABCD", 0},
+        {2, "A,Z", 0},
+        {2, "", 0},
+        {3, "A,C", 1},
+        {3, "a, e", 1},
+        {3, "C", 0.5},
+    }
+    for _, tt := range tests {
+        p := problems[tt.problem]
+        if got := p.grade(tt.given); got != tt.credit {
+            t.Errorf("%s, %q: got credit %v, want %v", p.q, tt.given, got, tt.credit)
+        }
+    }
+}
+
+func TestShuffledOptionsKeepAnswers(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", choiceProblems)
+    original := loadFile(t, "problems.yaml", choiceProblems)
+    for seed := int64(1); seed <= 10; seed++ {
+        shuffled := shuffleOptions(problems, rand.New(rand.NewSource(seed)))
+        for i, p := range shuffled {
+            // the correct options by text, found again by label
+            var labels []string
+            for j, o := range p.options {
+                for _, a := range p.answers {
+                    if o == a {
+                        labels = append(labels, label(j))
+                    }
+                }
+            }
+            if got := p.grade(strings.Join(labels, ",")); got != 1 {
+                t.Errorf("seed %d, %s: options %v, %v got credit %v", seed, p.q, p.options, labels, got)
+            }
+            if p.kind == trueFalse && strings.Join(p.options, ",") != "True,False" {
+                t.Errorf("seed %d: true/false options were shuffled to %v", seed, p.options)
+            }
+            if strings.Join(problems[i].options, ",") != strings.Join(original[i].options, ",") {
+                t.Errorf("seed %d: shuffling changed the options of the original %s", seed, p.q)
+            }
+        }
+    }
+}
+
+func TestInvalidChoices(t *testing.T) {
+    for _, yml := range []string{
+        "- question: q\n  options: [a, b]\n  answer: C\n",
+        "- question: q\n  type: choice\n  options: [a, b]\n  answer: [A, B]\n",
+        "- question: q\n  type: choice\n  options: [a]\n  answer: A\n",
+        "- question: q\n  type: tf\n  options: [a, b]\n  answer: A\n",
+        "- question: q\n  type: multi\n  options: [a, b]\n  answer: A,Q\n",
+    } {
+        src, err := openSource(writeFile(t, "problems.yaml", yml), "")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err := loadProblems(src, matchRule{}); err == nil {
+            t.Errorf("no error loading\n%s", yml)
+        }
+    }
+}
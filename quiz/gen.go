@@ -0,0 +1,253 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "strconv"
+    "strings"
+)
+
+// genSpec describes generated arithmetic problems. It's written as a
+// comma separated list of key=value settings, e.g.
+//
+//     ops=+-*/,min=1,max=12,terms=3,count=20
+//
+//     ops     operators to use, any of + - * / (default +-)
+//     min     smallest operand (default 0)
+//     max     largest operand (default 10)
+//     terms   operands per problem (default 2)
+//     count   number of problems (default 10)
+//     dec     decimal places of the operands (default 0)
+//     neg     allow negative operands and answers (neg or neg=true)
+//     intdiv  only divide when the result is a whole number (intdiv or
+//             intdiv=true)
+//     seed    seed for the generator, so a set can be repeated
+type genSpec struct {
+    ops    string
+    min    float64
+    max    float64
+    terms  int
+    count  int
+    dec    int
+    neg    bool
+    intdiv bool
+    seed   int64
+}
+
+func parseGenSpec(s string) (genSpec, error) {
+    spec := genSpec{ops: "+-", min: 0, max: 10, terms: 2, count: 10}
+    for _, setting := range strings.Split(s, ",") {
+        key, value, hasValue := strings.Cut(strings.TrimSpace(setting), "=")
+        var err error
+        switch key {
+        case "":
+        case "ops":
+            spec.ops = value
+            if value == "" || strings.Trim(value, "+-*/") != "" {
+                return spec, fmt.Errorf("invalid ops %q. Must be made of + - * /", value)
+            }
+        case "min":
+            spec.min, err = strconv.ParseFloat(value, 64)
+        case "max":
+            spec.max, err = strconv.ParseFloat(value, 64)
+        case "terms":
+            spec.terms, err = strconv.Atoi(value)
+        case "count":
+            spec.count, err = strconv.Atoi(value)
+        case "dec":
+            spec.dec, err = strconv.Atoi(value)
+        case "neg":
+            spec.neg, err = switchValue(value, hasValue)
+        case "intdiv":
+            spec.intdiv, err = switchValue(value, hasValue)
+        case "seed":
+            spec.seed, err = strconv.ParseInt(value, 10, 64)
+        default:
+            return spec, fmt.Errorf("unknown generator setting %q", key)
+        }
+        if err != nil {
+            return spec, fmt.Errorf("invalid %s %q", key, value)
+        }
+    }
+    switch {
+    case spec.min > spec.max:
+        return spec, fmt.Errorf("min %v is larger than max %v", spec.min, spec.max)
+    case spec.terms < 2:
+        return spec, fmt.Errorf("terms must be at least 2")
+    case spec.count < 1:
+        return spec, fmt.Errorf("count must be at least 1")
+    case spec.dec < 0 || spec.dec > 6:
+        return spec, fmt.Errorf("dec must be between 0 and 6")
+    case spec.intdiv && spec.dec > 0:
+        return spec, fmt.Errorf("intdiv only works with whole numbers (dec=0)")
+    }
+    return spec, nil
+}
+
+// switchValue parses the value of an on/off setting, which is on when
+// it's given without a value.
+func switchValue(value string, hasValue bool) (bool, error) {
+    if !hasValue {
+        return true, nil
+    }
+    return strconv.ParseBool(value)
+}
+
+// genSource is a ProblemSource making up arithmetic problems from a spec.
+type genSource struct {
+    spec genSpec
+}
+
+// newGenSource parses spec, using seed unless the spec sets its own.
+func newGenSource(spec string, seed int64) (genSource, error) {
+    s, err := parseGenSpec(spec)
+    if err != nil {
+        return genSource{}, err
+    }
+    if s.seed == 0 {
+        s.seed = seed
+    }
+    return genSource{s}, nil
+}
+
+// problems that can't be made to fit the spec are retried this many times
+const genAttempts = 1000
+
+func (g genSource) Records() ([]Record, error) {
+    rng := rand.New(rand.NewSource(g.spec.seed))
+    records := make([]Record, g.spec.count)
+    for i := range records {
+        q, a, ok := "", 0.0, false
+        for try := 0; try < genAttempts && !ok; try++ {
+            q, a, ok = g.problem(rng)
+        }
+        if !ok {
+            return nil, fmt.Errorf("can't generate problems for this spec, try a wider range of operands")
+        }
+        fields := map[string]any{
+            "question": q,
+            "answer":   g.format(a),
+            "category": "arithmetic",
+            "match":    g.match(),
+        }
+        records[i] = Record{Fields: fields, Pos: fmt.Sprintf("generated:%d", i+1)}
+    }
+    return records, nil
+}
+
+// problem makes one expression and its value. ok is false if it doesn't
+// fit the spec (a negative answer, division by zero, ...).
+//
+// Operators are picked first and operands after, so a division can pick
+// its divisor knowing the value of the product it divides.
+func (g genSource) problem(rng *rand.Rand) (q string, a float64, ok bool) {
+    ops := make([]byte, g.spec.terms-1)
+    for i := range ops {
+        ops[i] = g.spec.ops[rng.Intn(len(g.spec.ops))]
+    }
+
+    var b strings.Builder
+    // sum of the finished terms, and the value of the term (product)
+    // still being built, so * and / bind tighter than + and -
+    sum, term := 0.0, g.operand(rng)
+    sign := 1.0
+    b.WriteString(g.show(term))
+    for _, op := range ops {
+        var x float64
+        if op == '/' {
+            var found bool
+            x, found = g.divisor(rng, term)
+            if !found {
+                return "", 0, false
+            }
+        } else {
+            x = g.operand(rng)
+        }
+        b.WriteByte(op)
+        b.WriteString(g.show(x))
+        switch op {
+        case '*':
+            term *= x
+        case '/':
+            term /= x
+        case '+', '-':
+            sum += sign * term
+            sign = 1
+            if op == '-' {
+                sign = -1
+            }
+            term = x
+        }
+    }
+    a = sum + sign*term
+    if !g.spec.neg && a < 0 {
+        return "", 0, false
+    }
+    return b.String(), a, true
+}
+
+func (g genSource) operand(rng *rand.Rand) float64 {
+    lo, hi := g.spec.min, g.spec.max
+    if g.spec.neg && lo > -hi {
+        lo = -hi
+    }
+    unit := math.Pow(10, float64(g.spec.dec))
+    steps := int64(math.Round((hi - lo) * unit))
+    return math.Round(lo*unit+float64(rng.Int63n(steps+1))) / unit
+}
+
+// divisor picks a non zero operand to divide n by, one that divides it
+// evenly with intdiv.
+func (g genSource) divisor(rng *rand.Rand, n float64) (float64, bool) {
+    for try := 0; try < 50; try++ {
+        x := g.operand(rng)
+        if x == 0 {
+            continue
+        }
+        if g.spec.intdiv && math.Mod(n, x) != 0 {
+            continue
+        }
+        return x, true
+    }
+    return 0, false
+}
+
+// show formats an operand, negative ones in parentheses.
+func (g genSource) show(x float64) string {
+    s := strconv.FormatFloat(x, 'f', g.spec.dec, 64)
+    if x < 0 {
+        return "(" + s + ")"
+    }
+    return s
+}
+
+// answerDec is the decimal places answers are rounded to. Products add up
+// the places of their operands and divisions rarely come out even, so
+// anything but whole numbers gets two places at least.
+func (g genSource) answerDec() int {
+    if g.spec.dec == 0 && (g.spec.intdiv || !strings.Contains(g.spec.ops, "/")) {
+        return 0
+    }
+    if g.spec.dec < 2 {
+        return 2
+    }
+    return g.spec.dec
+}
+
+func (g genSource) format(a float64) string {
+    s := strconv.FormatFloat(a, 'f', g.answerDec(), 64)
+    if s == "-0" {
+        s = "0"
+    }
+    return s
+}
+
+// match accepts any way of writing the right number, within rounding.
+func (g genSource) match() string {
+    dec := g.answerDec()
+    if dec == 0 {
+        return "numeric"
+    }
+    return fmt.Sprintf("numeric=%g", 0.5*math.Pow(10, -float64(dec)))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+    "math"
+    "math/rand"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// eval works out a generated question: numbers, negative ones in
+// parentheses, and + - * / with the usual precedence.
+func eval(t *testing.T, q string) (value float64, operands []float64) {
+    t.Helper()
+    sum, term, sign := 0.0, 0.0, 1.0
+    op := byte(0)
+    for len(q) > 0 {
+        var s string
+        if q[0] == '(' {
+            end := strings.IndexByte(q, ')')
+            s, q = q[1:end], q[end+1:]
+        } else {
+            end := strings.IndexAny(q, "+-*/")
+            if end < 0 {
+                end = len(q)
+            }
+            s, q = q[:end], q[end:]
+        }
+        x, err := strconv.ParseFloat(s, 64)
+        if err != nil {
+            t.Fatalf("bad operand %q", s)
+        }
+        operands = append(operands, x)
+        switch op {
+        case 0:
+            term = x
+        case '*':
+            term *= x
+        case '/':
+            term /= x
+        case '+', '-':
+            sum += sign * term
+            sign = 1
+            if op == '-' {
+                sign = -1
+            }
+            term = x
+        }
+        if len(q) > 0 {
+            op, q = q[0], q[1:]
+        }
+    }
+    return sum + sign*term, operands
+}
+
+func TestGenProblem(t *testing.T) {
+    specs := []string{
+        "",
+        "ops=+-*/,min=1,max=12,terms=3",
+        "ops=/,min=0,max=20,intdiv",
+        "ops=-,min=0,max=5,terms=4",
+        "ops=*-,min=1,max=9,neg",
+        "ops=+*,min=0,max=2,dec=2",
+        "ops=/,min=1,max=10,dec=1",
+    }
+    for _, s := range specs {
+        g, err := newGenSource(s, 1)
+        if err != nil {
+            t.Fatalf("%q: %s", s, err)
+        }
+        rng := rand.New(rand.NewSource(1))
+        for i := 0; i < 500; i++ {
+            q, a, ok := g.problem(rng)
+            if !ok {
+                continue
+            }
+            want, operands := eval(t, q)
+            if len(operands) != g.spec.terms {
+                t.Errorf("%q: %s has %d operands, want %d", s, q, len(operands), g.spec.terms)
+            }
+            lo := g.spec.min
+            if g.spec.neg {
+                lo = -g.spec.max
+            }
+            unit := math.Pow(10, float64(g.spec.dec))
+            for _, x := range operands {
+                if x < lo || x > g.spec.max {
+                    t.Errorf("%q: operand %v of %s is out of range", s, x, q)
+                }
+                if math.Abs(x*unit-math.Round(x*unit)) > 1e-6 {
+                    t.Errorf("%q: operand %v of %s has more than %d decimals", s, x, q, g.spec.dec)
+                }
+            }
+            if math.Abs(a-want) > 1e-9 {
+                t.Errorf("%q: %s = %v, got %v", s, q, want, a)
+            }
+            if !g.spec.neg && a < 0 {
+                t.Errorf("%q: %s has a negative answer", s, q)
+            }
+            if g.spec.intdiv && a != math.Trunc(a) {
+                t.Errorf("%q: %s isn't a whole number", s, q)
+            }
+            if strings.Contains(q, "/0") && !strings.Contains(q, "/0.") {
+                t.Errorf("%q: %s divides by zero", s, q)
+            }
+        }
+    }
+}
+
+func TestGenRecords(t *testing.T) {
+    g, err := newGenSource("ops=/,min=1,max=10,count=30", 7)
+    if err != nil {
+        t.Fatal(err)
+    }
+    problems, err := loadProblems(g, matchRule{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(problems) != 30 {
+        t.Fatalf("got %d problems, want 30", len(problems))
+    }
+    for _, p := range problems {
+        want, _ := eval(t, p.q)
+        // answers are rounded to 2 places, any way of writing them works
+        if !p.accepts(strconv.FormatFloat(want, 'f', -1, 64)) {
+            t.Errorf("%s = %v isn't accepted, answer is %v", p.q, want, p.answers)
+        }
+    }
+    again, _ := loadProblems(g, matchRule{})
+    for i := range problems {
+        if problems[i].q != again[i].q {
+            t.Fatalf("the same seed made %s and then %s", problems[i].q, again[i].q)
+        }
+    }
+}
+
+func TestParseGenSpecErrors(t *testing.T) {
+    for _, s := range []string{
+        "ops=x",
+        "ops=",
+        "min=5,max=1",
+        "terms=1",
+        "count=0",
+        "dec=7",
+        "dec=1,intdiv",
+        "max=ten",
+        "size=3",
+        "neg=maybe",
+        "intdiv=",
+    } {
+        if _, err := parseGenSpec(s); err == nil {
+            t.Errorf("%q: no error", s)
+        }
+    }
+}
+
+func TestParseGenSpecSwitches(t *testing.T) {
+    tests := []struct {
+        s      string
+        neg    bool
+        intdiv bool
+    }{
+        {"", false, false},
+        {"neg,intdiv", true, true},
+        {"neg=true,intdiv=1", true, true},
+        {"neg=false,intdiv=false", false, false},
+        {"neg=0,intdiv", false, true},
+        {"neg=FALSE", false, false},
+    }
+    for _, tt := range tests {
+        spec, err := parseGenSpec(tt.s)
+        if err != nil {
+            t.Fatalf("%q: %s", tt.s, err)
+        }
+        if spec.neg != tt.neg || spec.intdiv != tt.intdiv {
+            t.Errorf("%q: got neg %v, intdiv %v, want %v, %v", tt.s, spec.neg, spec.intdiv, tt.neg, tt.intdiv)
+        }
+    }
+}
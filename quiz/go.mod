@@ -1,3 +1,10 @@
 module example/quiz
 
 go 1.19
+
+require (
+	github.com/boltdb/bolt v1.3.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.7.0 // indirect
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// gradeSheet grades a file of submitted answers against problems without
+// asking anything. The sheet is csv, either "question,answer" rows that
+// are matched to problems by question, or single column rows holding the
+// answers in the same order as the problems. A first row naming its
+// columns ("question" or "answer") is a header and isn't graded. Problems
+// without an answer count as skipped.
+func gradeSheet(filename string, problems []Problem) (Results, error) {
+    f, err := os.Open(filename)
+    if err != nil {
+        return Results{}, fmt.Errorf("Failed to open file: %s!", filename)
+    }
+    defer f.Close()
+    r := csv.NewReader(f)
+    r.FieldsPerRecord = -1
+    r.TrimLeadingSpace = true
+
+    byQuestion := make(map[string]int, len(problems))
+    for i, p := range problems {
+        byQuestion[p.q] = i
+    }
+    given := make(map[int]string)
+    row := 0
+    for first := true; ; first = false {
+        cells, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return Results{}, fmt.Errorf("%s: %w", filename, err)
+        }
+        if first && sheetHeader(cells) {
+            continue
+        }
+        line, _ := r.FieldPos(0)
+        i := row
+        row++
+        answer := cells[0]
+        if len(cells) > 1 {
+            q := strings.TrimSpace(cells[0])
+            var ok bool
+            if i, ok = byQuestion[q]; !ok {
+                return Results{}, fmt.Errorf("%s: no problem with question %q", pos(filename, line), q)
+            }
+            answer = cells[1]
+        }
+        if i >= len(problems) {
+            return Results{}, fmt.Errorf("%s: more answers than the %d problems", pos(filename, line), len(problems))
+        }
+        if _, dup := given[i]; dup {
+            return Results{}, fmt.Errorf("%s: %q is answered twice", pos(filename, line), problems[i].q)
+        }
+        given[i] = strings.TrimSpace(answer)
+    }
+
+    res := Results{total: len(problems)}
+    for i, p := range problems {
+        // empty cells are skipped questions
+        if answer, ok := given[i]; ok && !skipped(answer) {
+            res.add(p.answer(i, answer))
+        }
+    }
+    return res, nil
+}
+
+// sheetHeader reports whether cells name the columns of a sheet, like the
+// header of a problems csv.
+func sheetHeader(cells []string) bool {
+    for _, cell := range cells {
+        cell = strings.TrimSpace(cell)
+        if strings.EqualFold(cell, "question") || strings.EqualFold(cell, "answer") {
+            return true
+        }
+    }
+    return false
+}
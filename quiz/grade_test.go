@@ -0,0 +1,46 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestGradeSheet(t *testing.T) {
+    tests := []struct {
+        name     string
+        sheet    string
+        answered int
+        correct  int
+        err      string
+    }{
+        {"in order", "2\n5\n6\n", 3, 2, ""},
+        {"by question", "question C,6\nquestion A,2\n", 2, 2, ""},
+        {"header", "question,answer\nquestion B,4\n", 1, 1, ""},
+        {"header in order", "answer\n2\n4\n6\n", 3, 3, ""},
+        {"fewer answers", "2\n", 1, 1, ""},
+        {"blank answer", "question A,\nquestion B,4\n", 1, 1, ""},
+        {"unknown question", "question D,8\n", 0, 0, "no problem with question"},
+        {"too many answers", "2\n4\n6\n8\n", 0, 0, "more answers than the 3 problems"},
+        {"answered twice", "question A,2\nquestion A,3\n", 0, 0, "answered twice"},
+        // only the first row can be a header
+        {"late header", "question A,2\nquestion,answer\n", 0, 0, "no problem with question"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            res, err := gradeSheet(writeFile(t, "answers.csv", tt.sheet), arithmetic("2", "4", "6"))
+            if tt.err != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.err) {
+                    t.Fatalf("got error %v, want one containing %q", err, tt.err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if res.total != 3 || res.answered != tt.answered || res.correct != tt.correct {
+                t.Errorf("got %d of %d answered, %d correct, want %d answered, %d correct",
+                    res.answered, res.total, res.correct, tt.answered, tt.correct)
+            }
+        })
+    }
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "sort"
+    "time"
+
+    "github.com/boltdb/bolt"
+)
+
+// Run is the record of a single quiz, as kept in the history store.
+type Run struct {
+    User      string
+    Source    string
+    Time      time.Time
+    Total     int              // problems in the quiz, asked or not
+    Questions []QuestionResult // the problems that were asked
+}
+
+type QuestionResult struct {
+    Question string
+    Category string
+    Correct  bool
+    TimedOut bool
+    Latency  time.Duration
+}
+
+// History is the local store of past runs.
+//
+//     k: time the run started: RFC3339Nano, then #<sequence number> as
+//        runs of a room all start at the same time
+//     v: serialized Run ([]byte)
+type History struct {
+    db *bolt.DB
+}
+
+func OpenHistory() (*History, error) {
+    dir, err := appDir()
+    if err != nil {
+        return nil, err
+    }
+    db, err := bolt.Open(filepath.Join(dir, "history.db"), 0600, &bolt.Options{Timeout: time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists([]byte("runs"))
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &History{db}, nil
+}
+
+func (h *History) Close() error {
+    return h.db.Close()
+}
+
+// runs are keyed by the time they started, in UTC and with every
+// fraction digit so the keys sort like the times do
+const runKeyLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// runKey is the key of run, the seq-th one stored. seq tells apart runs
+// started at the same time, like the runs of a room.
+func runKey(run Run, seq uint64) []byte {
+    return []byte(fmt.Sprintf("%s#%020d", run.Time.UTC().Format(runKeyLayout), seq))
+}
+
+// Add stores run under the time it started.
+func (h *History) Add(run Run) error {
+    return h.db.Update(func(tx *bolt.Tx) error {
+        dat, err := json.Marshal(&run)
+        if err != nil {
+            return err
+        }
+        b := tx.Bucket([]byte("runs"))
+        seq, err := b.NextSequence()
+        if err != nil {
+            return err
+        }
+        return b.Put(runKey(run, seq), dat)
+    })
+}
+
+// Runs returns every stored run oldest first.
+func (h *History) Runs() ([]Run, error) {
+    runs := make([]Run, 0)
+    err := h.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket([]byte("runs")).ForEach(func(k, v []byte) error {
+            var run Run
+            if err := json.Unmarshal(v, &run); err != nil {
+                return err
+            }
+            runs = append(runs, run)
+            return nil
+        })
+    })
+    // keys written before runKeyLayout don't always sort by time
+    sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+    return runs, err
+}
+
+// newRun builds the history record of a finished quiz.
+func newRun(user, source string, start time.Time, problems []Problem, res Results) Run {
+    run := Run{
+        User:      user,
+        Source:    source,
+        Time:      start,
+        Total:     res.total,
+        Questions: make([]QuestionResult, len(res.answers)),
+    }
+    for i, a := range res.answers {
+        p := problems[a.index]
+        run.Questions[i] = QuestionResult{
+            Question: p.q,
+            Category: p.category,
+            Correct:  a.isCorrect,
+            TimedOut: a.timedOut,
+            Latency:  a.latency,
+        }
+    }
+    return run
+}
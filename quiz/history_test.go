@@ -0,0 +1,53 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestHistoryKeepsRunsStartedTogether(t *testing.T) {
+    t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+    h, err := OpenHistory()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer h.Close()
+    // every player of a room starts at the same time
+    now := time.Now()
+    for _, user := range []string{"ana", "bo", "cy"} {
+        if err := h.Add(Run{User: user, Source: "room", Time: now}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    runs, err := h.Runs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(runs) != 3 {
+        t.Fatalf("got %d runs, want 3", len(runs))
+    }
+    for i, user := range []string{"ana", "bo", "cy"} {
+        if runs[i].User != user {
+            t.Errorf("run %d: got user %q, want %q", i, runs[i].User, user)
+        }
+    }
+}
+
+func TestRunKeysSortByTime(t *testing.T) {
+    base := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+    times := []time.Time{
+        base,
+        base.Add(100 * time.Millisecond),
+        base.Add(120 * time.Millisecond),
+        base.Add(123456789 * time.Nanosecond),
+        base.Add(time.Second),
+        // the same instant in another zone
+        base.Add(2 * time.Second).In(time.FixedZone("", -5*60*60)),
+    }
+    for i := 1; i < len(times); i++ {
+        prev, cur := string(runKey(Run{Time: times[i-1]}, 9)), string(runKey(Run{Time: times[i]}, 1))
+        if prev >= cur {
+            t.Errorf("key %s of %s sorts after key %s of %s", prev, times[i-1], cur, times[i])
+        }
+    }
+}
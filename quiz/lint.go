@@ -0,0 +1,216 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// lintCmd checks problem files without running a quiz and reports every
+// problem found, not just the first, so a question bank can be checked
+// before changes to it are merged. Exits with status 1 if anything was
+// found.
+func lintCmd(args []string) {
+    fs := flag.NewFlagSet("lint", flag.ExitOnError)
+    format := fs.String("format", "", "format of the files: csv, json, yaml or text. defaults to the file extension")
+    matchSpec := fs.String("match", "exact", "match rule for problems that don't set their own, as for the quiz")
+    fs.Usage = func() {
+        fmt.Fprintln(fs.Output(), "usage: quiz lint [flags] file...")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    files := fs.Args()
+    if len(files) == 0 {
+        files = []string{"problems.csv"}
+    }
+    match, err := parseMatchRule(*matchSpec)
+    if err != nil {
+        exit(err.Error())
+    }
+
+    l := linter{match: match, seen: make(map[string]lintEntry)}
+    for _, filename := range files {
+        l.file(filename, *format)
+    }
+    for _, f := range l.findings {
+        fmt.Println(f)
+    }
+    if len(l.findings) > 0 {
+        fmt.Printf("%d problems found in %d questions\n", len(l.findings), l.questions)
+        os.Exit(1)
+    }
+    fmt.Printf("ok, %d questions checked\n", l.questions)
+}
+
+// linter collects findings over several files, so duplicates are found
+// across files too.
+type linter struct {
+    match     matchRule
+    seen      map[string]lintEntry // by normalized question
+    questions int
+    findings  []string
+}
+
+// lintEntry is the first occurrence of a question.
+type lintEntry struct {
+    pos     string
+    answers []string
+}
+
+func (l *linter) report(pos, format string, args ...any) {
+    l.findings = append(l.findings, pos+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *linter) file(filename, format string) {
+    src, err := openSource(filename, format)
+    if err != nil {
+        l.findings = append(l.findings, err.Error())
+        return
+    }
+    records, err := src.Records()
+    if err != nil {
+        l.findings = append(l.findings, err.Error())
+        return
+    }
+    for _, rec := range records {
+        l.questions++
+        l.record(rec)
+    }
+}
+
+func (l *linter) record(rec Record) {
+    if rec.Err != nil {
+        l.report(rec.Pos, "%s", rec.Err)
+        return
+    }
+    // metadata is checked field by field so a row with several bad
+    // columns gets them all reported
+    bad := false
+    check := func(field string, err error) {
+        if err != nil {
+            l.report(rec.Pos, "%s: %s", field, err)
+            bad = true
+        }
+    }
+    if d := rec.str("difficulty"); d != "" {
+        _, err := parseDifficulty(d)
+        check("difficulty", err)
+    }
+    if pts := rec.str("points"); pts != "" {
+        if n, err := strconv.ParseFloat(pts, 64); err != nil || n < 0 {
+            check("points", fmt.Errorf("invalid points %q", pts))
+        }
+    }
+    if t := rec.str("time"); t != "" {
+        _, err := parseLimit(t)
+        check("time", err)
+    }
+    match := l.match
+    if spec := rec.str("match"); spec != "" {
+        m, err := parseMatchRule(spec)
+        check("match", err)
+        match = m
+    }
+    if t := rec.str("type"); t != "" {
+        if _, ok := kindNames[strings.ToLower(t)]; !ok {
+            check("type", fmt.Errorf("unknown question type %q", t))
+        }
+    }
+    if empty := emptyAnswers(rec, !match.regex); empty > 0 {
+        l.report(rec.Pos, "answer has %d empty alternatives", empty)
+    }
+
+    var p Problem
+    if !bad {
+        var err error
+        p, err = rec.problem(l.match)
+        if err != nil {
+            l.report(rec.Pos, "%s", err)
+            return
+        }
+        if p.match.numeric && !p.kind.choice() {
+            for _, a := range p.answers {
+                if _, err := strconv.ParseFloat(a, 64); err != nil {
+                    l.report(rec.Pos, "answer %q is not a number", a)
+                }
+            }
+        }
+    }
+
+    q := rec.str("question")
+    if q == "" {
+        return
+    }
+    answers := p.answers
+    if bad {
+        answers = rec.answers(!match.regex)
+    }
+    key := strings.ToLower(strings.Join(strings.Fields(q), " "))
+    first, dup := l.seen[key]
+    if !dup {
+        l.seen[key] = lintEntry{rec.Pos, answers}
+        return
+    }
+    if sameAnswers(first.answers, answers) {
+        l.report(rec.Pos, "duplicate question %q, first at %s", q, first.pos)
+    } else {
+        l.report(rec.Pos, "conflicting answers for %q: %s here, %s at %s",
+            q, strings.Join(answers, "|"), strings.Join(first.answers, "|"), first.pos)
+    }
+}
+
+// emptyAnswers counts the blank alternatives in the answer of rec, like
+// "4||four" or an empty list item, which splitList quietly drops.
+func emptyAnswers(rec Record, split bool) int {
+    v, ok := rec.Fields["answer"]
+    if !ok {
+        v = rec.Fields["answers"]
+    }
+    var raw []string
+    switch v := v.(type) {
+    case nil:
+        return 0
+    case []any:
+        for _, a := range v {
+            raw = append(raw, text(a))
+        }
+    default:
+        s := strings.TrimSpace(text(v))
+        if s == "" {
+            // reported as a missing answer
+            return 0
+        }
+        raw = []string{s}
+        if split {
+            raw = strings.Split(s, "|")
+        }
+    }
+    n := 0
+    for _, a := range raw {
+        if strings.TrimSpace(a) == "" {
+            n++
+        }
+    }
+    return n
+}
+
+// sameAnswers reports whether a and b accept the same answers, in any
+// order.
+func sameAnswers(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    x := append([]string(nil), a...)
+    y := append([]string(nil), b...)
+    sort.Strings(x)
+    sort.Strings(y)
+    for i := range x {
+        if x[i] != y[i] {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestLintReportsEveryBadRecord(t *testing.T) {
+    files := map[string]string{
+        "a.csv": "question,answer\n" +
+            "5+5,10\n" +
+            "1+1,2,extra\n" +
+            "\"bad\"quote,1\n" +
+            "2+2,4\n" +
+            "2+2,5\n",
+        "b.json": `[{"question": "3+3", "answer": "6"},
+ "oops",
+ {"question": "3+3", "answer": "6"}]`,
+        "c.yaml": "- question: 4+4\n  answer: 8\n- just text\n- question: 4+4\n  answer: 8\n",
+        "d.txt": "A: stray\nQ: 6+6\nA: 12\nnonsense\nQ: 6+6\nA: 12\n",
+    }
+    l := linter{seen: make(map[string]lintEntry)}
+    for _, name := range []string{"a.csv", "b.json", "c.yaml", "d.txt"} {
+        l.file(writeFile(t, name, files[name]), "")
+    }
+    want := []string{
+        "a.csv:3: row has 3 columns, expected at most 2",
+        "a.csv:4: extraneous or missing \" in quoted-field",
+        "a.csv:6: conflicting answers for \"2+2\": 5 here, 4 at ",
+        "b.json:2: expected a problem, got a string",
+        "b.json:3: duplicate question \"3+3\", first at ",
+        "c.yaml:3: expected a problem, got \"just text\"",
+        "c.yaml:4: duplicate question \"4+4\", first at ",
+        "d.txt:1: \"A: stray\" before the first Q: line",
+        "d.txt:4: expected a \"Key: value\" line",
+    }
+    if len(l.findings) != len(want) {
+        t.Fatalf("got %d findings, want %d:\n%s", len(l.findings), len(want), strings.Join(l.findings, "\n"))
+    }
+    for i, f := range l.findings {
+        if !strings.Contains(f, string(filepath.Separator)+want[i]) {
+            t.Errorf("finding %d: got %q, want %q...", i, f, want[i])
+        }
+    }
+}
+
+func TestTextPreambleBeforeFirstQuestion(t *testing.T) {
+    for _, content := range []string{
+        "Title: x\nAuthor: y\nQ: 1+1\nA: 2\n",
+        "A: x\nA) y\nQ: 1+1\nA: 2\n",
+        "A) y\nnonsense\nQ: 1+1\nA: 2\n",
+    } {
+        filename := writeFile(t, "d.txt", content)
+        l := linter{seen: make(map[string]lintEntry)}
+        l.file(filename, "")
+        if len(l.findings) != 1 || !strings.Contains(l.findings[0], "d.txt:1: ") || !strings.Contains(l.findings[0], "before the first Q: line") {
+            t.Errorf("%q: got findings %q", content, l.findings)
+        }
+        src, err := openSource(filename, "")
+        if err != nil {
+            t.Fatal(err)
+        }
+        records, err := src.Records()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(records) != 2 || records[1].str("question") != "1+1" || records[1].str("answer") != "2" {
+            t.Errorf("%q: got records %+v", content, records)
+        }
+    }
+}
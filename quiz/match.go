@@ -0,0 +1,184 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// matchRule decides when a user's answer counts as one of the accepted
+// answers. The zero value only ignores leading and trailing whitespace.
+//
+// Rules are written as a comma separated list of modes, e.g. "case,space"
+// or "numeric=0.01":
+//
+//     exact        compare as is (the default)
+//     case         ignore case
+//     space        collapse runs of whitespace into one space
+//     numeric[=t]  compare as numbers, equal within tolerance t (default 0)
+//     regex        accepted answers are regular expressions
+//     fuzzy[=n]    allow up to n edits (Levenshtein distance, default 1)
+type matchRule struct {
+    fold    bool
+    space   bool
+    numeric bool
+    tol     float64
+    regex   bool
+    fuzzy   int
+}
+
+func parseMatchRule(spec string) (matchRule, error) {
+    var m matchRule
+    for _, mode := range strings.Split(spec, ",") {
+        name, arg, hasArg := strings.Cut(strings.TrimSpace(mode), "=")
+        switch strings.ToLower(name) {
+        case "", "exact":
+        case "case":
+            m.fold = true
+        case "space":
+            m.space = true
+        case "numeric":
+            m.numeric = true
+            if hasArg {
+                tol, err := strconv.ParseFloat(arg, 64)
+                if err != nil || tol < 0 {
+                    return m, fmt.Errorf("invalid numeric tolerance %q", arg)
+                }
+                m.tol = tol
+            }
+        case "regex":
+            m.regex = true
+        case "fuzzy":
+            m.fuzzy = 1
+            if hasArg {
+                n, err := strconv.Atoi(arg)
+                if err != nil || n < 0 {
+                    return m, fmt.Errorf("invalid fuzzy distance %q", arg)
+                }
+                m.fuzzy = n
+            }
+        default:
+            return m, fmt.Errorf("unknown match mode %q. Must be exact, case, space, numeric, regex or fuzzy.", name)
+        }
+    }
+    if m.regex && (m.numeric || m.fuzzy > 0) {
+        return m, fmt.Errorf("regex matching can't be combined with numeric or fuzzy")
+    }
+    return m, nil
+}
+
+// normalize applies the rule's text normalization to s.
+func (m matchRule) normalize(s string) string {
+    s = strings.TrimSpace(s)
+    if m.space {
+        s = strings.Join(strings.Fields(s), " ")
+    }
+    if m.fold {
+        s = strings.ToLower(s)
+    }
+    return s
+}
+
+// compile checks every accepted answer can be used with the rule and,
+// for regex rules, returns the compiled patterns.
+func (m matchRule) compile(accepted []string) ([]*regexp.Regexp, error) {
+    if !m.regex {
+        return nil, nil
+    }
+    patterns := make([]*regexp.Regexp, len(accepted))
+    for i, a := range accepted {
+        expr := "^(?:" + a + ")$"
+        if m.fold {
+            expr = "(?i)" + expr
+        }
+        re, err := regexp.Compile(expr)
+        if err != nil {
+            return nil, fmt.Errorf("invalid answer pattern %q: %w", a, err)
+        }
+        patterns[i] = re
+    }
+    return patterns, nil
+}
+
+// accepts reports whether given matches any of the problem's answers.
+func (p Problem) accepts(given string) bool {
+    for i := range p.answers {
+        if p.matches(given, i) {
+            return true
+        }
+    }
+    return false
+}
+
+// matches reports whether given matches the i-th accepted answer.
+func (p Problem) matches(given string, i int) bool {
+    m := p.match
+    g := m.normalize(given)
+    if m.regex {
+        return p.patterns[i].MatchString(g)
+    }
+    a := p.answers[i]
+    if m.numeric && numericEqual(g, a, m.tol) {
+        return true
+    }
+    a = m.normalize(a)
+    return g == a || (m.fuzzy > 0 && levenshtein(g, a) <= m.fuzzy)
+}
+
+// numericEqual reports whether a and b are both numbers within tol of
+// each other. Being off by exactly tol counts, float rounding or not:
+// 0.375 is within 0.005 of 0.38.
+func numericEqual(a, b string, tol float64) bool {
+    x, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+    if err != nil {
+        return false
+    }
+    y, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+    if err != nil {
+        return false
+    }
+    return math.Abs(x-y) <= tol*(1+1e-9)
+}
+
+// levenshtein returns the number of single rune insertions, deletions or
+// substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+    if a == b {
+        return 0
+    }
+    ra, rb := []rune(a), []rune(b)
+    if len(ra) == 0 {
+        return utf8.RuneCountInString(b)
+    }
+    // prev and cur are the previous and current rows of the edit matrix
+    prev := make([]int, len(rb)+1)
+    cur  := make([]int, len(rb)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+    for i := 1; i <= len(ra); i++ {
+        cur[0] = i
+        for j := 1; j <= len(rb); j++ {
+            cost := 1
+            if ra[i-1] == rb[j-1] {
+                cost = 0
+            }
+            cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+        }
+        prev, cur = cur, prev
+    }
+    return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+    if b < a {
+        a = b
+    }
+    if c < a {
+        a = c
+    }
+    return a
+}
@@ -0,0 +1,115 @@
+package main
+
+import "testing"
+
+func TestParseMatchRule(t *testing.T) {
+    tests := []struct {
+        spec string
+        want matchRule
+    }{
+        {"", matchRule{}},
+        {"exact", matchRule{}},
+        {"case,space", matchRule{fold: true, space: true}},
+        {" Case , SPACE ", matchRule{fold: true, space: true}},
+        {"numeric", matchRule{numeric: true}},
+        {"numeric=0.01", matchRule{numeric: true, tol: 0.01}},
+        {"regex,case", matchRule{regex: true, fold: true}},
+        {"fuzzy", matchRule{fuzzy: 1}},
+        {"fuzzy=2,case", matchRule{fuzzy: 2, fold: true}},
+        {"fuzzy=0", matchRule{}},
+    }
+    for _, tt := range tests {
+        got, err := parseMatchRule(tt.spec)
+        if err != nil {
+            t.Errorf("%q: %s", tt.spec, err)
+            continue
+        }
+        if got != tt.want {
+            t.Errorf("%q: got %+v, want %+v", tt.spec, got, tt.want)
+        }
+    }
+    for _, spec := range []string{"loose", "numeric=x", "numeric=-1", "fuzzy=-1", "fuzzy=1.5", "regex,numeric", "regex,fuzzy"} {
+        if _, err := parseMatchRule(spec); err == nil {
+            t.Errorf("%q: no error", spec)
+        }
+    }
+}
+
+func TestMatches(t *testing.T) {
+    tests := []struct {
+        spec    string
+        answers []string
+        given   string
+        want    bool
+    }{
+        {"exact", []string{"Paris"}, "Paris", true},
+        {"exact", []string{"Paris"}, "  Paris ", true},
+        {"exact", []string{"Paris"}, "paris", false},
+        {"case", []string{"Paris"}, "PARIS", true},
+        {"exact", []string{"New York"}, "New  York", false},
+        {"space", []string{"New York"}, "New \t York", true},
+        {"space", []string{"New York"}, "new york", false},
+        {"numeric", []string{"10"}, "10.0", true},
+        {"numeric", []string{"10"}, "1e1", true},
+        {"numeric", []string{"10"}, "10.1", false},
+        {"numeric=0.01", []string{"3.14"}, "3.1416", true},
+        {"numeric=0.01", []string{"3.14"}, "3.2", false},
+        // numbers that aren't are still compared as text
+        {"numeric", []string{"ten"}, "ten", true},
+        {"regex", []string{`colou?r`}, "color", true},
+        {"regex", []string{`colou?r`}, "colors", false},
+        {"regex", []string{`colou?r`}, "Colour", false},
+        {"regex,case", []string{`colou?r`}, "Colour", true},
+        {"regex", []string{`a|b`}, "ab", false},
+        {"fuzzy", []string{"Mississippi"}, "Missisippi", true},
+        {"fuzzy", []string{"Mississippi"}, "Misisipi", false},
+        {"fuzzy=3", []string{"Mississippi"}, "Misisipi", true},
+        {"fuzzy,case", []string{"Berlin"}, "BERLN", true},
+        {"exact", []string{"4", "four"}, "four", true},
+        {"exact", []string{"4", "four"}, "for", false},
+    }
+    for _, tt := range tests {
+        m, err := parseMatchRule(tt.spec)
+        if err != nil {
+            t.Fatal(err)
+        }
+        p := Problem{answers: tt.answers, match: m}
+        if p.patterns, err = m.compile(tt.answers); err != nil {
+            t.Fatal(err)
+        }
+        if got := p.accepts(tt.given); got != tt.want {
+            t.Errorf("%s %q accepts %q: got %v, want %v", tt.spec, tt.answers, tt.given, got, tt.want)
+        }
+    }
+}
+
+func TestCompileBadPattern(t *testing.T) {
+    if _, err := (matchRule{regex: true}).compile([]string{"(unclosed"}); err == nil {
+        t.Error("no error for an invalid pattern")
+    }
+}
+
+func TestLevenshtein(t *testing.T) {
+    tests := []struct {
+        a, b string
+        want int
+    }{
+        {"", "", 0},
+        {"", "abc", 3},
+        {"abc", "", 3},
+        {"abc", "abc", 0},
+        {"kitten", "sitting", 3},
+        {"flaw", "lawn", 2},
+        {"ab", "ba", 2},
+        {"héllo", "hello", 1},
+        {"日本", "日本語", 1},
+    }
+    for _, tt := range tests {
+        if got := levenshtein(tt.a, tt.b); got != tt.want {
+            t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+        }
+        if got := levenshtein(tt.b, tt.a); got != tt.want {
+            t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const helpText = `Commands, typed instead of an answer:
+    :skip (or just Enter)  skip the question, you'll get back to it at the end
+    :back                  go back to the previous question that has time left
+    :goto N                go to question N
+    :review                list your answers so far
+    :submit                hand in your answers now
+    :help                  show this help
+Answers can be changed until they're handed in, as long as there's time left.`
+
+// sheet holds the answers of a quiz in progress. Nothing is final until
+// it's submitted, except questions that ran out of time.
+type sheet struct {
+    problems []Problem
+    perLimit time.Duration
+    answers  []*Answer       // nil while unanswered
+    spent    []time.Duration // time spent on each question over all visits
+    timeUp   []bool          // ran out of time, the answer can't change
+    now      func() time.Time
+}
+
+func newSheet(problems []Problem, perLimit time.Duration) *sheet {
+    return &sheet{
+        problems: problems,
+        perLimit: perLimit,
+        answers:  make([]*Answer, len(problems)),
+        spent:    make([]time.Duration, len(problems)),
+        timeUp:   make([]bool, len(problems)),
+        now:      time.Now,
+    }
+}
+
+// the passes runQuiz makes over the problems
+const (
+    firstPass   = iota // every problem in order
+    skippedPass        // back to the ones that were skipped
+    reviewing          // answers are listed and may be changed
+)
+
+// runQuiz asks every problem in turn, then the skipped ones once more,
+// then lists the answers for a last review until they're submitted or
+// ctx, the deadline for the whole quiz, runs out. Questions with a time
+// limit of their own (or perLimit) are counted as wrong when it runs out,
+// over all visits to the question. Whatever was answered by the time the
+// quiz ends is sent on ansCh.
+func runQuiz(ctx context.Context, problems []Problem, perLimit time.Duration, in *lineReader, ansCh chan<- Answer) error {
+    sh := newSheet(problems, perLimit)
+    defer sh.submit(ansCh)
+
+    // in the review, i is -1 while the list is shown
+    mode, i := firstPass, 0
+    for {
+        switch {
+        case mode == firstPass && i >= len(problems):
+            mode, i = skippedPass, sh.nextOpen(0)
+            if i >= 0 {
+                fmt.Printf("\nBack to the %d questions you skipped.\n", sh.open())
+            }
+            continue
+        case mode == skippedPass && i < 0:
+            mode = reviewing
+        }
+        if mode == reviewing && i < 0 {
+            done, next, err := sh.review(ctx, in)
+            if done || err != nil {
+                return err
+            }
+            i = next
+        }
+
+        line, err := sh.ask(ctx, i, in)
+        if err != nil {
+            return err
+        }
+        cmd, arg, _ := strings.Cut(line, " ")
+        switch strings.ToLower(cmd) {
+        case ":back":
+            if n := sh.prevOpen(i - 1); n >= 0 {
+                i = n
+            }
+            continue
+        case ":goto":
+            if n, ok := sh.questionNumber(arg); ok {
+                i = n
+            }
+            continue
+        case ":review":
+            sh.list()
+            continue
+        case ":submit":
+            return nil
+        case ":help":
+            fmt.Println(helpText)
+            continue
+        case "", ":skip":
+        default:
+            if strings.HasPrefix(cmd, ":") {
+                fmt.Printf("Unknown command %s\n%s\n", cmd, helpText)
+                continue
+            }
+        }
+        // answered, skipped or out of time, on to the next one
+        switch mode {
+        case firstPass:
+            i++
+        case skippedPass:
+            i = sh.nextOpen(i + 1)
+        case reviewing:
+            i = -1
+        }
+    }
+}
+
+// ask shows problem i until it's answered, a command is typed or its time
+// runs out. Answers are graded and written to the sheet, the line typed
+// is returned so runQuiz can act on commands and skips.
+func (sh *sheet) ask(ctx context.Context, i int, in *lineReader) (string, error) {
+    p := sh.problems[i]
+    prompt := fmt.Sprintf("%d. %s", i+1, p.prompt())
+    if a := sh.answers[i]; a != nil {
+        prompt = fmt.Sprintf("%d. (answered %s) %s", i+1, a.given, p.prompt())
+    }
+    limit := p.timeLimit(sh.perLimit)
+    if limit > 0 {
+        limit -= sh.spent[i]
+        // getUserAnswer takes 0 for no limit, so don't ask at all
+        if limit <= 0 {
+            fmt.Printf("Question %d ran out of time\n", i+1)
+            sh.lock(i)
+            return "", nil
+        }
+    }
+    shown := sh.now()
+    line, err := getUserAnswer(ctx, prompt, limit, in)
+    sh.spent[i] += sh.now().Sub(shown)
+    switch {
+    case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+        // only this question ran out of time
+        fmt.Println("\nOut of time for this one!")
+        sh.lock(i)
+        return "", nil
+    case err != nil:
+        return "", err
+    }
+    if line == "" || strings.HasPrefix(line, ":") {
+        return line, nil
+    }
+    a := p.answer(i, line)
+    a.latency = sh.spent[i]
+    sh.answers[i] = &a
+    return line, nil
+}
+
+// review lists the answers and asks whether to submit them. Enter or
+// :submit submits, a question number goes back to that question.
+func (sh *sheet) review(ctx context.Context, in *lineReader) (done bool, next int, err error) {
+    for {
+        fmt.Println()
+        sh.list()
+        fmt.Print("Enter (or :submit) to hand in your answers, or a question number to change one: ")
+        line, err := in.ReadLine(ctx)
+        switch {
+        case err == io.EOF:
+            // nothing more to read, hand in what there is
+            return true, 0, nil
+        case err != nil:
+            return false, 0, err
+        case line == "" || strings.EqualFold(line, ":submit"):
+            return true, 0, nil
+        }
+        if n, ok := sh.questionNumber(strings.TrimPrefix(line, ":goto ")); ok {
+            return false, n, nil
+        }
+    }
+}
+
+// questionNumber parses s as the number of a question that can still be
+// answered and returns its index.
+func (sh *sheet) questionNumber(s string) (int, bool) {
+    n, err := strconv.Atoi(strings.TrimSpace(s))
+    if err != nil || n < 1 || n > len(sh.problems) {
+        fmt.Printf("%q is not a question number, pick 1 to %d\n", s, len(sh.problems))
+        return 0, false
+    }
+    if sh.locked(n - 1) {
+        fmt.Printf("Question %d ran out of time\n", n)
+        return 0, false
+    }
+    return n - 1, true
+}
+
+// locked reports whether question i ran out of time and can't be
+// answered anymore.
+func (sh *sheet) locked(i int) bool {
+    return sh.timeUp[i]
+}
+
+// lock closes question i once its time is up. An answer given in time
+// stands, a question without one counts as out of time.
+func (sh *sheet) lock(i int) {
+    sh.timeUp[i] = true
+    if sh.answers[i] == nil {
+        sh.answers[i] = &Answer{index: i, timedOut: true, latency: sh.spent[i]}
+    }
+}
+
+// prevOpen returns the last question up to i that can still be
+// answered, -1 if there's none.
+func (sh *sheet) prevOpen(i int) int {
+    for ; i >= 0; i-- {
+        if !sh.locked(i) {
+            return i
+        }
+    }
+    return -1
+}
+
+// nextOpen returns the first unanswered question from i on, -1 if
+// there's none.
+func (sh *sheet) nextOpen(i int) int {
+    for ; i < len(sh.answers); i++ {
+        if sh.answers[i] == nil {
+            return i
+        }
+    }
+    return -1
+}
+
+// open counts the unanswered questions.
+func (sh *sheet) open() int {
+    n := 0
+    for _, a := range sh.answers {
+        if a == nil {
+            n++
+        }
+    }
+    return n
+}
+
+// list prints every question with its answer so far.
+func (sh *sheet) list() {
+    for i, p := range sh.problems {
+        given := "(skipped)"
+        switch a := sh.answers[i]; {
+        case a != nil && a.timedOut:
+            given = "(out of time)"
+        case a != nil && sh.locked(i):
+            given = a.given + " (out of time, can't change)"
+        case a != nil:
+            given = a.given
+        }
+        fmt.Printf("%3d. %s = %s\n", i+1, p.q, given)
+    }
+}
+
+// submit sends the answers on ansCh in question order. Skipped questions
+// aren't sent.
+func (sh *sheet) submit(ansCh chan<- Answer) {
+    for _, a := range sh.answers {
+        if a != nil {
+            ansCh <- *a
+        }
+    }
+}
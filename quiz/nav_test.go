@@ -0,0 +1,145 @@
+package main
+
+import (
+    "context"
+    "io"
+    "testing"
+    "time"
+)
+
+func arithmetic(answers ...string) []Problem {
+    var problems []Problem
+    for i, a := range answers {
+        problems = append(problems, Problem{q: "question " + string(rune('A'+i)), answers: []string{a}, points: 1})
+    }
+    return problems
+}
+
+// quizInput feeds lines to runQuiz through a pipe, each after its delay.
+type quizInput struct {
+    line  string
+    delay time.Duration
+}
+
+func runWith(t *testing.T, problems []Problem, perLimit time.Duration, input []quizInput) []Answer {
+    t.Helper()
+    r, w := io.Pipe()
+    go func() {
+        for _, in := range input {
+            time.Sleep(in.delay)
+            if _, err := io.WriteString(w, in.line+"\n"); err != nil {
+                return
+            }
+        }
+        w.Close()
+    }()
+    ansCh := make(chan Answer, len(problems))
+    err := runQuiz(context.Background(), problems, perLimit, newLineReader(r), ansCh)
+    r.Close()
+    if err != nil {
+        t.Fatalf("runQuiz: %s", err)
+    }
+    close(ansCh)
+    var answers []Answer
+    for a := range ansCh {
+        answers = append(answers, a)
+    }
+    return answers
+}
+
+func TestRunQuizNavigation(t *testing.T) {
+    answers := runWith(t, arithmetic("2", "4", "6"), 0, []quizInput{
+        {line: ""},        // skip 1
+        {line: "5"},       // 2, wrong
+        {line: "6"},       // 3
+        {line: "2"},       // back to the skipped 1
+        {line: "2"},       // review: change 2
+        {line: "4"},
+        {line: ":submit"},
+    })
+    if len(answers) != 3 {
+        t.Fatalf("got %d answers, want 3: %+v", len(answers), answers)
+    }
+    for i, a := range answers {
+        if a.index != i || !a.isCorrect {
+            t.Errorf("answer %d: got %+v, want question %d answered correctly", i, a, i)
+        }
+    }
+}
+
+func TestRunQuizBackSkipsTimedOut(t *testing.T) {
+    problems := arithmetic("2", "4")
+    problems[0].limit = 50 * time.Millisecond
+    answers := runWith(t, problems, 0, []quizInput{
+        {line: ":back", delay: 150 * time.Millisecond}, // 1 timed out, asked at 2
+        {line: "2"},                                    // still at 2, wrong
+        {line: ":goto 1"},                              // refused in the review
+        {line: ""},
+    })
+    if len(answers) != 2 {
+        t.Fatalf("got %d answers, want 2: %+v", len(answers), answers)
+    }
+    if !answers[0].timedOut || answers[0].isCorrect {
+        t.Errorf("question 1: got %+v, want it timed out", answers[0])
+    }
+    if answers[1].given != "2" {
+        t.Errorf("question 2: got %+v, want the answer 2", answers[1])
+    }
+}
+
+func TestAskRefusesWithoutTimeLeft(t *testing.T) {
+    problems := arithmetic("2")
+    sh := newSheet(problems, time.Second)
+    sh.spent[0] = time.Second
+    r, w := io.Pipe()
+    defer w.Close()
+    // nothing is ever written, asking would block until the context ends
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    line, err := sh.ask(ctx, 0, newLineReader(r))
+    if err != nil || line != "" {
+        t.Fatalf("got %q, %v", line, err)
+    }
+    if !sh.locked(0) {
+        t.Errorf("question without time left isn't locked")
+    }
+}
+
+func TestRevisitAfterTimeUpKeepsAnswer(t *testing.T) {
+    problems := arithmetic("2", "4")
+    problems[0].limit = 100 * time.Millisecond
+    answers := runWith(t, problems, 0, []quizInput{
+        {line: "2"},                                // 1, answered in time
+        {line: ":back"},                            // back to 1 from 2
+        {line: "4", delay: 200 * time.Millisecond}, // 1 ran out, asked at 2
+        {line: ":goto 1"},                          // refused in the review
+        {line: ""},
+    })
+    if len(answers) != 2 {
+        t.Fatalf("got %d answers, want 2: %+v", len(answers), answers)
+    }
+    if answers[0].timedOut || !answers[0].isCorrect || answers[0].given != "2" {
+        t.Errorf("question 1: got %+v, want the answer given in time", answers[0])
+    }
+    if !answers[1].isCorrect {
+        t.Errorf("question 2: got %+v, want it answered correctly", answers[1])
+    }
+}
+
+func TestAskKeepsAnswerWithoutTimeLeft(t *testing.T) {
+    problems := arithmetic("2")
+    sh := newSheet(problems, time.Second)
+    a := problems[0].answer(0, "2")
+    sh.answers[0] = &a
+    sh.spent[0] = time.Second
+    r, w := io.Pipe()
+    defer w.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    if _, err := sh.ask(ctx, 0, newLineReader(r)); err != nil {
+        t.Fatal(err)
+    }
+    if !sh.locked(0) || sh.answers[0].timedOut || !sh.answers[0].isCorrect {
+        t.Errorf("got locked %v and answer %+v, want the correct answer kept and locked", sh.locked(0), sh.answers[0])
+    }
+}
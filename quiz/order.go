@@ -0,0 +1,93 @@
+package main
+
+import (
+    "math"
+    "math/rand"
+    "sort"
+)
+
+// ordering is how the problems of a quiz are ordered and sampled.
+type ordering struct {
+    shuffle  bool
+    weighted bool
+    options  bool // shuffle the options of choice questions
+    n        int  // ask at most n problems, 0 for all
+}
+
+// shuffled returns a copy of problems in the order o asks for. Sampling
+// (see ordering.sample) is left to the caller, so it can filter the problems
+// first.
+func (o ordering) shuffled(problems []Problem, rng *rand.Rand) []Problem {
+    ps := make([]Problem, len(problems))
+    copy(ps, problems)
+    switch {
+    case o.weighted:
+        weightedShuffle(ps, rng)
+    case o.shuffle:
+        shuffleProblems(ps, rng)
+    }
+    if o.options {
+        ps = shuffleOptions(ps, rng)
+    }
+    return ps
+}
+
+// shuffleProblems puts problems in random order.
+func shuffleProblems(problems []Problem, rng *rand.Rand) {
+    rng.Shuffle(len(problems), func(i, j int) {
+        problems[i], problems[j] = problems[j], problems[i]
+    })
+}
+
+// weightedShuffle puts problems in random order where harder problems
+// tend to come first, so sampling the first n favours them. A problem of
+// difficulty 3 is three times as likely to be picked as one of difficulty
+// 1 (unrated problems count as 1).
+//
+// Each problem gets the key u^(1/w) for a uniform random u and weight w,
+// sorting by key is then a weighted sample without replacement
+// (Efraimidis & Spirakis).
+func weightedShuffle(problems []Problem, rng *rand.Rand) {
+    keys := make([]float64, len(problems))
+    for i, p := range problems {
+        w := float64(p.difficulty)
+        if w < 1 {
+            w = 1
+        }
+        keys[i] = math.Pow(rng.Float64(), 1/w)
+    }
+    sort.Sort(byKey{problems, keys})
+}
+
+// byKey sorts problems by descending key
+type byKey struct {
+    problems []Problem
+    keys     []float64
+}
+
+func (b byKey) Len() int           { return len(b.problems) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+    b.problems[i], b.problems[j] = b.problems[j], b.problems[i]
+    b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// sample returns a random o.n of problems, or all of them if o.n <= 0.
+// Shuffled problems are already in random order so the first o.n are
+// taken, otherwise the picked problems keep the order they came in.
+func (o ordering) sample(problems []Problem, rng *rand.Rand) []Problem {
+    n := o.n
+    if n <= 0 || n >= len(problems) {
+        return problems
+    }
+    if o.shuffle || o.weighted {
+        return problems[:n]
+    }
+    picked := rng.Perm(len(problems))[:n]
+    sort.Ints(picked)
+    ps := make([]Problem, n)
+    for i, j := range picked {
+        ps[i] = problems[j]
+    }
+    return ps
+}
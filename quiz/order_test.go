@@ -0,0 +1,51 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "reflect"
+    "testing"
+)
+
+func asked(problems []Problem) []string {
+    var qs []string
+    for _, p := range problems {
+        qs = append(qs, p.q)
+    }
+    return qs
+}
+
+func TestSample(t *testing.T) {
+    problems := arithmetic("1", "2", "3", "4", "5", "6", "7", "8")
+    first := asked(problems[:3])
+    o := ordering{n: 3}
+    seen := make(map[string]bool)
+    for seed := int64(1); seed <= 20; seed++ {
+        got := asked(o.sample(problems, rand.New(rand.NewSource(seed))))
+        again := asked(o.sample(problems, rand.New(rand.NewSource(seed))))
+        if !reflect.DeepEqual(got, again) {
+            t.Fatalf("seed %d: got %v and then %v", seed, got, again)
+        }
+        if len(got) != 3 {
+            t.Fatalf("seed %d: got %v, want 3 problems", seed, got)
+        }
+        for i := 1; i < len(got); i++ {
+            if got[i-1] >= got[i] {
+                t.Errorf("seed %d: got %v, want them in file order", seed, got)
+            }
+        }
+        seen[fmt.Sprint(got)] = true
+    }
+    if len(seen) < 2 {
+        t.Errorf("every seed sampled the same problems: %v", seen)
+    }
+
+    // shuffled problems are already random, the first n are kept
+    o.shuffle = true
+    if got := asked(o.sample(problems, rand.New(rand.NewSource(1)))); !reflect.DeepEqual(got, first) {
+        t.Errorf("shuffled: got %v, want %v", got, first)
+    }
+    if got := (ordering{}).sample(problems, nil); len(got) != len(problems) {
+        t.Errorf("without -n: got %d problems, want all %d", len(got), len(problems))
+    }
+}
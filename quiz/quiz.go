@@ -1,129 +1,392 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
-    "strings"
+    "io"
+    "math/rand"
+    "net/http"
     "os"
+    "os/user"
+    "path/filepath"
+    "regexp"
     "flag"
-    "encoding/csv"
+    "strings"
     "time"
 )
 
 type Problem struct {
-    q string
-    a string
+    q          string
+    answers    []string // accepted answers, any one of them is correct
+    category   string
+    difficulty int      // 0 if the source doesn't rate it
+    points     float64
+    kind       questionKind
+    options    []string // for choice questions, shown labeled A, B, C...
+    match      matchRule
+    patterns   []*regexp.Regexp // compiled answers for regex matching
+    limit      time.Duration    // time allowed for this question, 0 for none
+    pos        string   // file:line the problem was loaded from
 }
 
 type Answer struct {
+    index     int  // of the problem in the quiz
+    given     string
     isCorrect bool
+    credit    float64 // fraction of the problem's points earned, 0 to 1
+    timedOut  bool
+    latency   time.Duration // from showing the question to the answer
+}
+
+// Results is what handleState has collected once the quiz is over.
+type Results struct {
+    correct  int
+    answered int
+    total    int
+    answers  []Answer // in the order they were submitted
+}
+
+// subcommands, anything else runs a quiz
+var commands = map[string]func(args []string){
+    "stats": statsCmd,
+    "join":  joinCmd,
+    "lint":  lintCmd,
 }
 
 func main() {
+    if len(os.Args) > 1 {
+        if cmd, ok := commands[os.Args[1]]; ok {
+            cmd(os.Args[2:])
+            return
+        }
+    }
 
     filename := flag.String(
-        "csv", 
+        "file", 
         "problems.csv", 
-        "a csv file in the format (question, answer). defaults to problems.csv",
+        "a csv, json, yaml or text file of problems. defaults to problems.csv",
+    )
+    flag.StringVar(filename, "csv", "problems.csv", "deprecated: same as -file")
+    format := flag.String(
+        "format",
+        "",
+        "the format of -file: csv, json, yaml or text. defaults to the file extension",
     )
     seconds := flag.Int(
         "time", 
         16,
-        "the time limit for the quiz (in seconds). defaults to 16s",
+        "the time limit for the quiz (in seconds), 0 for no limit. defaults to 16s",
     )
+    perQuestion := flag.Int(
+        "per-question",
+        0,
+        "the time limit for each question (in seconds) unless a problem sets its own. defaults to none",
+    )
+    matchSpec := flag.String(
+        "match",
+        "exact",
+        "how answers are compared unless a problem sets its own match rule.\n" +
+        "comma separated list of exact, case, space, numeric[=tolerance], regex, fuzzy[=distance]",
+    )
+    var order ordering
+    flag.BoolVar(&order.shuffle, "shuffle", false, "ask the problems in random order")
+    flag.IntVar(&order.n, "n", 0, "ask a random sample of n problems, the same one for the same -seed. defaults to all")
+    flag.BoolVar(&order.options, "shuffle-options", false, "show the options of choice questions in random order")
+    flag.BoolVar(
+        &order.weighted,
+        "weighted",
+        false,
+        "shuffle so harder problems are more likely to come first (and be sampled by -n)",
+    )
+    srs := flag.Bool(
+        "srs",
+        false,
+        "spaced repetition: only ask problems that are due, the ones you missed come back sooner",
+    )
+    userName := flag.String("user", defaultUser(), "who is taking the quiz, for -srs and the run history")
+    seed := flag.Int64("seed", 0, "seed for shuffling. defaults to a random seed")
+    record := flag.Bool("history", true, "record the run for `quiz stats`")
+    addr := flag.String(
+        "serve",
+        "",
+        "serve the quiz over http on this address (e.g. :8080) instead of in the terminal",
+    )
+    genSpec := flag.String(
+        "gen",
+        "",
+        "generate arithmetic problems instead of reading -file, e.g. \"ops=+-*/,max=12,count=20\".\n" +
+        "settings: ops, min, max, terms, count, dec, neg, intdiv, seed",
+    )
+    roomAddr := flag.String(
+        "room",
+        "",
+        "host a multi-player room on this address (e.g. :9000), players connect with `quiz join`",
+    )
+    players := flag.Int("players", 0, "with -room, start as soon as this many players have joined")
+    output := flag.String("output", "", "write a full report of the quiz as json, csv or junit")
+    outFile := flag.String("out", "", "the file -output writes to. defaults to stdout")
+    sheet := flag.String(
+        "answers",
+        "",
+        "grade a csv file of answers instead of asking the questions.\n" +
+        "rows are either question,answer or just the answers in the order of the problems",
+    )
+    var sc scoring
+    flag.Float64Var(
+        &sc.negative,
+        "negative",
+        0,
+        "fraction of a question's points taken off for a wrong answer, e.g. 0.25.\n" +
+        "skipped and timed out questions lose nothing",
+    )
+    flag.Float64Var(&sc.pass, "pass", 0, "percentage of the points needed to pass. exits with status 2 below it")
     flag.Parse()
 
-    file, err := os.Open(*filename)
-    if err != nil {
-        exit(fmt.Sprintf("Failed to open file: %s!", *filename))
+    if _, ok := reportWriters[*output]; *output != "" && !ok {
+        exit(fmt.Sprintf("unknown output format %q. Must be json, csv or junit.", *output))
     }
 
-    r := csv.NewReader(file)
-    lines, err := r.ReadAll()
+    if sc.negative < 0 || sc.negative > 1 {
+        exit("-negative must be between 0 and 1")
+    }
+    if sc.pass < 0 || sc.pass > 100 {
+        exit("-pass must be a percentage between 0 and 100")
+    }
+
+    match, err := parseMatchRule(*matchSpec)
     if err != nil {
-        exit(fmt.Sprintf("Something went wrong reading %s.", *filename))
+        exit(err.Error())
+    }
+    if *seed == 0 {
+        *seed = time.Now().UnixNano()
     }
 
-    problems, err := parseProblems(lines)
+    var src ProblemSource
+    if *genSpec != "" {
+        src, err = newGenSource(*genSpec, *seed)
+        *filename = "generated"
+    } else {
+        src, err = openSource(*filename, *format)
+    }
+    if err != nil {
+        exit(err.Error())
+    }
+    problems, err := loadProblems(src, match)
     if err != nil {
         exit(err.Error())
     }
 
-    ansCh  := make(chan Answer)
-    quitCh := make(chan int)
-    
-    // handles state changes (e.g. submitted answers and time limit reached)
-    go handleState(ansCh, quitCh, len(problems))
+    rng := rand.New(rand.NewSource(*seed))
+    perLimit := time.Duration(*perQuestion) * time.Second
 
-    // start timer
-    // note: time.NewTimer might be a better choice here
-    go func() {
-        time.Sleep(time.Duration(*seconds) * time.Second)
-        quitCh <- 0
-    }()
+    if *addr != "" {
+        srv := newServer(problems, order, rng)
+        srv.limit = time.Duration(*seconds) * time.Second
+        srv.perLimit = perLimit
+        srv.scoring = sc
+        if *record {
+            srv.source = sourceName(*filename)
+        }
+        fmt.Printf("Serving the quiz on %s\n", *addr)
+        exit(http.ListenAndServe(*addr, srv).Error())
+    }
 
-    // start quiz
-    fmt.Println("Ready, set, Go! (pun intended)")
-    for _, p := range problems {
-        answer, err := getUserAnswer(p)
-        if err != nil {
-            exit("Something went wrong reading your answer. Please try again.")
+    if *roomAddr != "" {
+        r := newRoom(order.sample(order.shuffled(problems, rng), rng), perLimit)
+        if *record {
+            r.source = sourceName(*filename)
+        }
+        if err := hostRoom(*roomAddr, r, *players); err != nil {
+            exit(err.Error())
         }
-        ansCh <- Answer{isCorrect: answer == p.a}
+        return
     }
-    fmt.Print("\nNice job!")
-    quitCh <- 0
-}
 
-func handleState(ansCh chan Answer, quitCh chan int, total int) {
-    correct  := 0
-    answered := 0
-    for {
-        select {
-        case a := <-ansCh:
-            answered++
-            if a.isCorrect {
-                correct++
+    var res Results
+    var cards *leitner
+    start := time.Now()
+    if *sheet != "" {
+        // batch grading, problems stay in file order to line up with the sheet
+        res, err = gradeSheet(*sheet, problems)
+        if err != nil {
+            exit(err.Error())
+        }
+    } else {
+        problems = order.shuffled(problems, rng)
+        if *srs {
+            if *userName == "" || strings.ContainsAny(*userName, `/\`) {
+                exit(fmt.Sprintf("invalid user name %q", *userName))
+            }
+            cards, err = openLeitner(*userName)
+            if err != nil {
+                exit(fmt.Sprintf("Failed to load spaced repetition state: %s", err))
+            }
+            problems = cards.Due(problems, time.Now())
+            if len(problems) == 0 {
+                fmt.Println("Nothing is due, come back later!")
+                return
             }
-        case <-quitCh:
-            displayResults(correct, answered, total)
-            return
+        }
+        problems = order.sample(problems, rng)
+
+        ctx := context.Background()
+        if *seconds > 0 {
+            var cancel context.CancelFunc
+            ctx, cancel = context.WithTimeout(ctx, time.Duration(*seconds) * time.Second)
+            defer cancel()
+        }
+
+        ansCh := make(chan Answer)
+        resCh := make(chan Results)
+
+        // handles state changes (submitted answers) until ansCh is closed
+        go handleState(ansCh, resCh, len(problems))
+
+        // start quiz
+        fmt.Println("Ready, set, Go! (pun intended)")
+        fmt.Println("Press Enter to skip a question, type :help for more commands.")
+        start = time.Now()
+        err = runQuiz(ctx, problems, perLimit, newLineReader(os.Stdin), ansCh)
+        close(ansCh)
+        res = <-resCh
+        switch {
+        case errors.Is(err, context.DeadlineExceeded):
+            fmt.Print("\nTime's up!")
+        case err == nil:
+            fmt.Print("\nNice job!")
+        }
+    }
+
+    // a report on stdout replaces the usual summary
+    if *output == "" || *outFile != "" {
+        displayResults(res, problems, sc)
+    }
+    if cards != nil {
+        now := time.Now()
+        for _, a := range res.answers {
+            cards.Update(problems[a.index], a.isCorrect, now)
+        }
+        if err := cards.Save(); err != nil {
+            fmt.Printf("Failed to save spaced repetition state: %s\n", err)
         }
     }
+    if *record {
+        if err := recordRun(newRun(*userName, sourceName(*filename), start, problems, res)); err != nil {
+            fmt.Printf("Failed to record run: %s\n", err)
+        }
+    }
+    if *output != "" {
+        r := newReport(*userName, sourceName(*filename), start, problems, res, sc)
+        if err := writeReport(*outFile, *output, r); err != nil {
+            exit(fmt.Sprintf("Failed to write report: %s", err))
+        }
+    }
+    if err != nil && !errors.Is(err, context.DeadlineExceeded) && err != io.EOF {
+        exit("Something went wrong reading your answer. Please try again.")
+    }
+    if sc.pass > 0 && !sc.passed(res.points(problems, sc)) {
+        os.Exit(2)
+    }
 }
 
-func displayResults(correct, answered, total int) {
+func handleState(ansCh <-chan Answer, resCh chan<- Results, total int) {
+    res := Results{total: total}
+    for a := range ansCh {
+        res.add(a)
+    }
+    resCh <- res
+}
+
+func (res *Results) add(a Answer) {
+    res.answers = append(res.answers, a)
+    if a.timedOut {
+        return
+    }
+    res.answered++
+    if a.isCorrect {
+        res.correct++
+    }
+}
+
+// timeLimit is the time allowed for p, def if it doesn't set its own.
+func (p Problem) timeLimit(def time.Duration) time.Duration {
+    if p.limit == 0 {
+        return def
+    }
+    return p.limit
+}
+
+func displayResults(res Results, problems []Problem, sc scoring) {
     score := 0.0
-    if answered > 0 {
-        score = float64(correct) / float64(answered) * 100
+    if res.answered > 0 {
+        score = float64(res.correct) / float64(res.answered) * 100
+    }
+    template := "\n\nYou answered %d out of %d questions and got %d/%d (%.2f%%) correct\n"
+    fmt.Printf(template, res.answered, res.total, res.correct, res.answered, score)
+    earned, possible := res.points(problems, sc)
+    fmt.Printf("You scored %.4g out of %.4g points (%.2f%%)\n", earned, possible, percent(earned, possible))
+    switch {
+    case sc.pass == 0:
+    case sc.passed(earned, possible):
+        fmt.Printf("Passed! (%g%% needed)\n", sc.pass)
+    default:
+        fmt.Printf("Failed, %g%% was needed to pass\n", sc.pass)
     }
-    template := "\n\nYou answered %d out of %d questions and got %d/%d (%.2f%%) correct\n\n"
-    fmt.Printf(template, correct, total, correct, answered, score)
-    os.Exit(0)
+    fmt.Println()
 }
 
-func getUserAnswer(p Problem) (string, error) {
-    fmt.Printf("%s = ", p.q)
-    var answer string
-    _, err := fmt.Scanln(&answer)
+// getUserAnswer shows prompt and waits for an answer until ctx is done
+// or limit (if non zero) has passed. The prompt shows the time left of
+// whichever deadline comes first.
+func getUserAnswer(ctx context.Context, prompt string, limit time.Duration, in *lineReader) (string, error) {
+    if limit > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, limit)
+        defer cancel()
+    }
+    deadline, ok := ctx.Deadline()
+    if !ok {
+        fmt.Printf("%s = ", prompt)
+        return in.ReadLine(ctx)
+    }
+    fmt.Printf("%s %s = ", remaining(deadline, time.Now()), prompt)
+    ctx, stop := context.WithCancel(ctx)
+    defer stop()
+    go countdown(ctx, deadline)
+    return in.ReadLine(ctx)
+}
+
+func recordRun(run Run) error {
+    h, err := OpenHistory()
     if err != nil {
-        return answer, err
+        return err
     }
-    return answer, nil
+    defer h.Close()
+    return h.Add(run)
 }
 
-func parseProblems(lines [][]string) ([]Problem, error) {
-    problems := make([]Problem, len(lines))
-    for i, line := range lines {
-        if len(line) != 2 {
-            return nil, fmt.Errorf("quiz question %d is formatted incorrectly. Must contain a question and answer column only.", i)
-        }
-        p := Problem{
-            q: line[0],
-            a: strings.TrimSpace(line[1]),
-        }
-        problems[i] = p
+// sourceName is how a problem file is identified in the run history, so
+// runs of the same file from different directories are grouped together.
+func sourceName(filename string) string {
+    if filename == "generated" {
+        return filename
+    }
+    abs, err := filepath.Abs(filename)
+    if err != nil {
+        return filename
+    }
+    return abs
+}
+
+// defaultUser is the name of the logged in user, or "" if it can't be
+// looked up.
+func defaultUser() string {
+    u, err := user.Current()
+    if err != nil {
+        return ""
     }
-    return problems, nil
+    return u.Username
 }
 
 func exit(m string) {
@@ -0,0 +1,196 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Report is the full, per question outcome of a quiz, for -output.
+type Report struct {
+    User      string           `json:"user"`
+    Source    string           `json:"source"`
+    Started   time.Time        `json:"started"`
+    Duration  float64          `json:"durationSeconds"`
+    Total     int              `json:"total"`
+    Answered  int              `json:"answered"`
+    Correct   int              `json:"correct"`
+    Points    float64          `json:"points"`
+    Possible  float64          `json:"possible"`
+    Passed    *bool            `json:"passed,omitempty"` // only with a pass mark
+    Questions []ReportQuestion `json:"questions"`
+}
+
+type ReportQuestion struct {
+    Index    int      `json:"index"`
+    Question string   `json:"question"`
+    Category string   `json:"category,omitempty"`
+    Expected []string `json:"expected"`
+    Given    string   `json:"given"`
+    Correct  bool     `json:"correct"`
+    Credit   float64  `json:"credit"`
+    Points   float64  `json:"points"`
+    TimedOut bool     `json:"timedOut"`
+    Skipped  bool     `json:"skipped"` // never answered, e.g. the quiz ran out of time first
+    Latency  float64  `json:"latencySeconds"`
+}
+
+// newReport lists every problem of the quiz, answered or not.
+func newReport(user, source string, start time.Time, problems []Problem, res Results, sc scoring) Report {
+    r := Report{
+        User:      user,
+        Source:    source,
+        Started:   start,
+        Duration:  time.Since(start).Seconds(),
+        Total:     res.total,
+        Answered:  res.answered,
+        Correct:   res.correct,
+        Questions: make([]ReportQuestion, len(problems)),
+    }
+    for i, p := range problems {
+        r.Questions[i] = ReportQuestion{
+            Index:    i + 1,
+            Question: p.q,
+            Category: p.category,
+            Expected: p.answers,
+            Skipped:  true,
+        }
+    }
+    r.Points, r.Possible = res.points(problems, sc)
+    if sc.pass > 0 {
+        passed := sc.passed(r.Points, r.Possible)
+        r.Passed = &passed
+    }
+    for _, a := range res.answers {
+        q := &r.Questions[a.index]
+        q.Given = a.given
+        q.Correct = a.isCorrect
+        q.Credit = a.credit
+        q.Points = sc.points(problems[a.index], a)
+        q.TimedOut = a.timedOut
+        q.Skipped = false
+        q.Latency = a.latency.Seconds()
+    }
+    return r
+}
+
+// supported -output formats
+var reportWriters = map[string]func(io.Writer, Report) error{
+    "json":  writeJSONReport,
+    "csv":   writeCSVReport,
+    "junit": writeJUnitReport,
+}
+
+// writeReport writes r in format to filename, or stdout if it's empty.
+func writeReport(filename, format string, r Report) error {
+    write, ok := reportWriters[format]
+    if !ok {
+        return fmt.Errorf("unknown output format %q. Must be json, csv or junit.", format)
+    }
+    if filename == "" {
+        return write(os.Stdout, r)
+    }
+    f, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    if err := write(f, r); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+func writeJSONReport(w io.Writer, r Report) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(r)
+}
+
+func writeCSVReport(w io.Writer, r Report) error {
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"index", "question", "category", "expected", "given", "correct", "credit", "points", "timed_out", "skipped", "latency_seconds"})
+    for _, q := range r.Questions {
+        cw.Write([]string{
+            strconv.Itoa(q.Index),
+            q.Question,
+            q.Category,
+            strings.Join(q.Expected, "|"),
+            q.Given,
+            strconv.FormatBool(q.Correct),
+            strconv.FormatFloat(q.Credit, 'f', -1, 64),
+            strconv.FormatFloat(q.Points, 'f', -1, 64),
+            strconv.FormatBool(q.TimedOut),
+            strconv.FormatBool(q.Skipped),
+            strconv.FormatFloat(q.Latency, 'f', 3, 64),
+        })
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+// junit xml, one test case per question so results show up in ci tools
+type junitSuite struct {
+    XMLName  xml.Name    `xml:"testsuite"`
+    Name     string      `xml:"name,attr"`
+    Tests    int         `xml:"tests,attr"`
+    Failures int         `xml:"failures,attr"`
+    Skipped  int         `xml:"skipped,attr"`
+    Time     string      `xml:"time,attr"`
+    Stamp    string      `xml:"timestamp,attr"`
+    Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+    Name      string        `xml:"name,attr"`
+    ClassName string        `xml:"classname,attr"`
+    Time      string        `xml:"time,attr"`
+    Failure   *junitFailure `xml:"failure,omitempty"`
+    Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+    Message string `xml:"message,attr"`
+}
+
+func writeJUnitReport(w io.Writer, r Report) error {
+    suite := junitSuite{
+        Name:  r.Source,
+        Tests: len(r.Questions),
+        Time:  strconv.FormatFloat(r.Duration, 'f', 3, 64),
+        Stamp: r.Started.Format("2006-01-02T15:04:05"),
+    }
+    for _, q := range r.Questions {
+        c := junitCase{
+            Name:      q.Question,
+            ClassName: q.Category,
+            Time:      strconv.FormatFloat(q.Latency, 'f', 3, 64),
+        }
+        switch {
+        case q.Skipped:
+            suite.Skipped++
+            c.Skipped = &struct{}{}
+        case q.TimedOut:
+            suite.Failures++
+            c.Failure = &junitFailure{"out of time"}
+        case !q.Correct:
+            suite.Failures++
+            c.Failure = &junitFailure{fmt.Sprintf("expected %s, got %q", strings.Join(q.Expected, " or "), q.Given)}
+        }
+        suite.Cases = append(suite.Cases, c)
+    }
+    io.WriteString(w, xml.Header)
+    enc := xml.NewEncoder(w)
+    enc.Indent("", "  ")
+    if err := enc.Encode(suite); err != nil {
+        return err
+    }
+    _, err := io.WriteString(w, "\n")
+    return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func testReport() Report {
+    problems := arithmetic("2", "4", "6", "8")
+    problems[1].category = "sums"
+    res := Results{total: len(problems)}
+    res.add(problems[0].answer(0, "2"))
+    res.add(problems[1].answer(1, "5"))
+    late := problems[2].answer(2, "6")
+    late.timedOut, late.isCorrect, late.credit = true, false, 0
+    res.add(late)
+    start := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+    return newReport("ann", "problems.csv", start, problems, res, scoring{pass: 50})
+}
+
+func TestReport(t *testing.T) {
+    r := testReport()
+    if r.Total != 4 || r.Correct != 1 || r.Points != 1 || r.Possible != 4 {
+        t.Errorf("got %d of %d correct, %v of %v points", r.Correct, r.Total, r.Points, r.Possible)
+    }
+    if r.Passed == nil || *r.Passed {
+        t.Errorf("got passed %v, want a 25%% score to fail", r.Passed)
+    }
+    var states []string
+    for _, q := range r.Questions {
+        switch {
+        case q.Skipped:
+            states = append(states, "skipped")
+        case q.TimedOut:
+            states = append(states, "timed out")
+        case q.Correct:
+            states = append(states, "correct")
+        default:
+            states = append(states, "wrong")
+        }
+    }
+    if want := []string{"correct", "wrong", "timed out", "skipped"}; !reflect.DeepEqual(states, want) {
+        t.Errorf("got questions %v, want %v", states, want)
+    }
+}
+
+func TestWriteJSONReport(t *testing.T) {
+    r := testReport()
+    var buf bytes.Buffer
+    if err := writeJSONReport(&buf, r); err != nil {
+        t.Fatal(err)
+    }
+    var got Report
+    if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, r) {
+        t.Errorf("got %+v back, want %+v", got, r)
+    }
+}
+
+func TestWriteCSVReport(t *testing.T) {
+    var buf bytes.Buffer
+    if err := writeCSVReport(&buf, testReport()); err != nil {
+        t.Fatal(err)
+    }
+    rows, err := csv.NewReader(&buf).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 5 || rows[0][0] != "index" {
+        t.Fatalf("got rows %q, want a header and 4 questions", rows)
+    }
+    want := []string{"2", "question B", "sums", "4", "5", "false", "0", "0", "false", "false", "0.000"}
+    if !reflect.DeepEqual(rows[2], want) {
+        t.Errorf("got row %q, want %q", rows[2], want)
+    }
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+    var buf bytes.Buffer
+    if err := writeJUnitReport(&buf, testReport()); err != nil {
+        t.Fatal(err)
+    }
+    var suite junitSuite
+    if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+        t.Fatal(err)
+    }
+    if suite.Tests != 4 || suite.Failures != 2 || suite.Skipped != 1 || len(suite.Cases) != 4 {
+        t.Errorf("got %d tests, %d failures, %d skipped, %d cases, want 4, 2, 1, 4",
+            suite.Tests, suite.Failures, suite.Skipped, len(suite.Cases))
+    }
+    if f := suite.Cases[1].Failure; f == nil || f.Message != `expected 4, got "5"` {
+        t.Errorf("got failure %+v for the wrong answer", f)
+    }
+    if f := suite.Cases[2].Failure; f == nil || f.Message != "out of time" {
+        t.Errorf("got failure %+v for the timed out answer", f)
+    }
+}
+
+func TestWriteReportFormat(t *testing.T) {
+    if err := writeReport("", "yaml", testReport()); err == nil {
+        t.Error("an unknown format wrote a report")
+    }
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "os"
+    "sort"
+    "strings"
+    "time"
+)
+
+// A room plays one quiz with several players connected over tcp (e.g.
+// with `quiz join` or netcat). Everyone gets the same question at the
+// same time, and a correct answer is worth more the faster it comes in.
+//
+// The protocol is plain lines of text: the first line a player sends is
+// their name, every line after that is an answer to the current question.
+//
+// Like handleState in the terminal quiz, a single goroutine (run) owns
+// all of the room's state. Connections only send it events.
+type room struct {
+    problems []Problem
+    perLimit time.Duration // per question, unless a problem sets its own
+    pause    time.Duration // between questions, to read the leaderboard
+    source   string        // runs are recorded to the history when set
+
+    events  chan roomEvent
+    players []*player // in the order they joined
+}
+
+// rooms always have a clock, this is it unless -per-question is set
+const defaultRoomLimit = 20 * time.Second
+
+type eventKind int
+
+const (
+    joined eventKind = iota
+    left
+    answered
+    started
+)
+
+type roomEvent struct {
+    kind   eventKind
+    player *player
+    text   string
+    at     time.Time
+}
+
+type player struct {
+    name    string
+    out     chan string   // written to the connection by its own goroutine
+    flushed chan struct{} // closed once out is closed and written
+    score   int
+    res     Results
+    // whether they've answered (or sat out) the current question
+    answered bool
+}
+
+// points for a correct answer, half for being right and half for speed
+const maxPoints = 1000
+
+func newRoom(problems []Problem, perLimit time.Duration) *room {
+    if perLimit == 0 {
+        perLimit = defaultRoomLimit
+    }
+    return &room{
+        problems: problems,
+        perLimit: perLimit,
+        pause:    3 * time.Second,
+        events:   make(chan roomEvent),
+    }
+}
+
+// hostRoom listens on addr and plays the quiz once the host presses
+// enter, or as soon as minPlayers have joined if it's non zero.
+func hostRoom(addr string, r *room, minPlayers int) error {
+    ln, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    defer ln.Close()
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go r.serveConn(conn)
+        }
+    }()
+    go func() {
+        // any line from the host starts the game
+        if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err == nil {
+            r.events <- roomEvent{kind: started}
+        }
+    }()
+    fmt.Printf("Room open on %s, join with `quiz join <host>%s`.\n", addr, addr)
+    if minPlayers > 0 {
+        fmt.Printf("The game starts when %d players have joined (or press enter).\n", minPlayers)
+    } else {
+        fmt.Println("Press enter to start the game.")
+    }
+    r.run(minPlayers)
+    return nil
+}
+
+// serveConn reads a player's name and then their answers, turning them
+// into events for the room.
+func (r *room) serveConn(conn net.Conn) {
+    defer conn.Close()
+    p := &player{out: make(chan string, 64), flushed: make(chan struct{})}
+    go func() {
+        defer close(p.flushed)
+        for msg := range p.out {
+            if _, err := io.WriteString(conn, msg); err != nil {
+                return
+            }
+        }
+    }()
+
+    sc := bufio.NewScanner(conn)
+    p.out <- "Your name? "
+    for p.name == "" {
+        if !sc.Scan() {
+            close(p.out)
+            return
+        }
+        p.name = strings.TrimSpace(sc.Text())
+    }
+    r.events <- roomEvent{kind: joined, player: p}
+    for sc.Scan() {
+        r.events <- roomEvent{kind: answered, player: p, text: sc.Text(), at: time.Now()}
+    }
+    r.events <- roomEvent{kind: left, player: p}
+}
+
+// run is the room's state goroutine: the lobby, then every question in
+// turn, then the final leaderboard.
+func (r *room) run(minPlayers int) {
+    // lobby
+    for ready := false; !ready; {
+        e := <-r.events
+        switch e.kind {
+        case started:
+            ready = len(r.players) > 0
+            if !ready {
+                fmt.Println("Nobody has joined yet.")
+            }
+        default:
+            r.handle(e, nil, time.Time{})
+            ready = minPlayers > 0 && len(r.players) >= minPlayers
+        }
+    }
+
+    r.broadcast("\nReady, set, Go! (pun intended)\n")
+    for i, p := range r.problems {
+        limit := p.timeLimit(r.perLimit)
+        shown := time.Now()
+        for _, pl := range r.players {
+            pl.answered = false
+        }
+        r.broadcast(fmt.Sprintf("\nQuestion %d/%d [%ds] %s = ", i+1, len(r.problems), int(limit.Seconds()), p.prompt()))
+        r.question(i, shown, time.NewTimer(limit))
+        r.broadcast(fmt.Sprintf("\nThe answer was %s\n%s", p.solution(), r.leaderboard()))
+        if i < len(r.problems)-1 {
+            r.wait(r.pause)
+        }
+    }
+    r.broadcast("\nThat's all folks! Final standings:\n" + r.leaderboard())
+    r.record()
+    for _, pl := range r.players {
+        close(pl.out)
+    }
+    for _, pl := range r.players {
+        select {
+        case <-pl.flushed:
+        case <-time.After(time.Second):
+        }
+    }
+}
+
+// question collects answers to problem i until everyone has answered or
+// the timer goes off.
+func (r *room) question(i int, shown time.Time, t *time.Timer) {
+    defer t.Stop()
+    for {
+        select {
+        case e := <-r.events:
+            r.handle(e, &i, shown)
+        case <-t.C:
+            for _, pl := range r.players {
+                if !pl.answered {
+                    pl.res.add(Answer{index: i, timedOut: true, latency: time.Since(shown)})
+                    pl.send("\nOut of time!\n")
+                }
+            }
+            return
+        }
+        if r.allAnswered() {
+            return
+        }
+    }
+}
+
+// wait keeps handling events (players joining and leaving) for d.
+func (r *room) wait(d time.Duration) {
+    t := time.NewTimer(d)
+    defer t.Stop()
+    for {
+        select {
+        case e := <-r.events:
+            r.handle(e, nil, time.Time{})
+        case <-t.C:
+            return
+        }
+    }
+}
+
+// handle applies a single event. current is the index of the question
+// being asked, nil if there is none.
+func (r *room) handle(e roomEvent, current *int, shown time.Time) {
+    pl := e.player
+    switch e.kind {
+    case joined:
+        r.players = append(r.players, pl)
+        pl.res.total = len(r.problems)
+        r.broadcast(fmt.Sprintf("%s joined (%d players)\n", pl.name, len(r.players)))
+        if current != nil {
+            // late joiners sit out the question in progress
+            pl.answered = true
+        }
+    case left:
+        for i := range r.players {
+            if r.players[i] == pl {
+                r.players = append(r.players[:i], r.players[i+1:]...)
+                close(pl.out)
+                r.broadcast(fmt.Sprintf("%s left (%d players)\n", pl.name, len(r.players)))
+                break
+            }
+        }
+    case answered:
+        if current == nil || pl.answered {
+            return
+        }
+        p := r.problems[*current]
+        limit := p.timeLimit(r.perLimit)
+        latency := e.at.Sub(shown)
+        a := p.answer(*current, e.text)
+        a.latency = latency
+        pl.answered = true
+        pl.res.add(a)
+        if a.isCorrect {
+            pl.score += speedPoints(latency, limit)
+        }
+        pl.send("Locked in, waiting for the others...\n")
+    }
+}
+
+// speedPoints scores a correct answer given after latency out of limit.
+func speedPoints(latency, limit time.Duration) int {
+    left := float64(limit-latency) / float64(limit)
+    if left < 0 {
+        left = 0
+    }
+    return int(maxPoints/2 + maxPoints/2*left)
+}
+
+func (r *room) allAnswered() bool {
+    for _, pl := range r.players {
+        if !pl.answered {
+            return false
+        }
+    }
+    return true
+}
+
+func (r *room) leaderboard() string {
+    ranked := make([]*player, len(r.players))
+    copy(ranked, r.players)
+    sort.SliceStable(ranked, func(i, j int) bool {
+        return ranked[i].score > ranked[j].score
+    })
+    var b strings.Builder
+    for i, pl := range ranked {
+        fmt.Fprintf(&b, "%2d. %-16s %6d  (%d/%d correct)\n", i+1, pl.name, pl.score, pl.res.correct, len(pl.res.answers))
+    }
+    return b.String()
+}
+
+// broadcast sends msg to every player and echoes it on the host's
+// terminal. Players too slow to keep up miss messages rather than
+// holding up the room.
+func (r *room) broadcast(msg string) {
+    fmt.Print(msg)
+    for _, pl := range r.players {
+        pl.send(msg)
+    }
+}
+
+// send queues msg for the player, dropping it if they're too far behind.
+func (pl *player) send(msg string) {
+    select {
+    case pl.out <- msg:
+    default:
+    }
+}
+
+// record adds every player's game to the run history.
+func (r *room) record() {
+    if r.source == "" {
+        return
+    }
+    now := time.Now()
+    for _, pl := range r.players {
+        if err := recordRun(newRun(pl.name, r.source, now, r.problems, pl.res)); err != nil {
+            log.Printf("failed to record run of %s: %s\n", pl.name, err)
+        }
+    }
+}
+
+// joinCmd implements `quiz join host:port`, connecting the terminal to a
+// room. netcat works just as well.
+func joinCmd(args []string) {
+    if len(args) != 1 {
+        exit("usage: quiz join host:port")
+    }
+    conn, err := net.Dial("tcp", args[0])
+    if err != nil {
+        exit(fmt.Sprintf("Failed to join %s: %s", args[0], err))
+    }
+    defer conn.Close()
+    go io.Copy(conn, os.Stdin)
+    io.Copy(os.Stdout, conn)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+    "strings"
+)
+
+// scoring turns graded answers into points.
+type scoring struct {
+    // fraction of a question's points taken off for a wrong answer.
+    // Questions that are skipped or run out of time lose nothing.
+    negative float64
+    // percentage of the possible points needed to pass, 0 for no pass mark
+    pass float64
+}
+
+// answer grades given as the answer to p, the i-th problem of the quiz.
+func (p Problem) answer(i int, given string) Answer {
+    credit := p.grade(given)
+    return Answer{index: i, given: given, credit: credit, isCorrect: credit == 1}
+}
+
+// grade returns the fraction of p's points that given earns. Only multi
+// select and multi part questions can earn part of their points.
+func (p Problem) grade(given string) float64 {
+    switch p.kind {
+    case multiSelect:
+        return p.creditPicks(given)
+    case multiPart:
+        return p.creditParts(given)
+    case singleChoice, trueFalse:
+        if p.acceptsChoice(given) {
+            return 1
+        }
+    default:
+        if p.accepts(given) {
+            return 1
+        }
+    }
+    return 0
+}
+
+// partialCredit gives credit for every right pick out of total and takes
+// it away for every wrong one, so picking everything earns nothing.
+func partialCredit(right, wrong, total int) float64 {
+    if total == 0 || right <= wrong {
+        return 0
+    }
+    return float64(right-wrong) / float64(total)
+}
+
+func (p Problem) creditPicks(given string) float64 {
+    picked, ok := p.picks(given)
+    if !ok {
+        return 0
+    }
+    correct := p.correctOptions()
+    right := 0
+    for i := range picked {
+        if correct[i] {
+            right++
+        }
+    }
+    return partialCredit(right, len(picked)-right, len(correct))
+}
+
+// creditParts grades a multi part answer: the parts are separated by
+// commas or semicolons, in any order, and each is matched against the
+// accepted parts with the problem's match rule.
+func (p Problem) creditParts(given string) float64 {
+    parts := strings.FieldsFunc(given, func(r rune) bool {
+        return r == ',' || r == ';'
+    })
+    used := make([]bool, len(p.answers))
+    right, wrong := 0, 0
+    for _, part := range parts {
+        if strings.TrimSpace(part) == "" {
+            continue
+        }
+        found := false
+        for i := range p.answers {
+            if !used[i] && p.matches(part, i) {
+                used[i], found = true, true
+                break
+            }
+        }
+        if found {
+            right++
+        } else {
+            wrong++
+        }
+    }
+    return partialCredit(right, wrong, len(p.answers))
+}
+
+// skipped reports whether given is no answer at all, which is never
+// marked down.
+func skipped(given string) bool {
+    return strings.TrimSpace(given) == ""
+}
+
+// points earned by a, negative if it was wrong and sc marks negatively.
+func (sc scoring) points(p Problem, a Answer) float64 {
+    if a.timedOut || skipped(a.given) {
+        return 0
+    }
+    // without negative marking a wrong answer is 0, not -0 in reports
+    if a.credit == 0 && sc.negative > 0 {
+        return -sc.negative * p.points
+    }
+    return a.credit * p.points
+}
+
+// points adds up the points earned in res out of the points of every
+// problem in the quiz, asked or not.
+func (res Results) points(problems []Problem, sc scoring) (earned, possible float64) {
+    for _, p := range problems {
+        possible += p.points
+    }
+    for _, a := range res.answers {
+        earned += sc.points(problems[a.index], a)
+    }
+    return earned, possible
+}
+
+// percent of possible that earned is, 0 if nothing was possible.
+func percent(earned, possible float64) float64 {
+    if possible == 0 {
+        return 0
+    }
+    return earned / possible * 100
+}
+
+// passed reports whether earned out of possible meets the pass mark.
+func (sc scoring) passed(earned, possible float64) bool {
+    return percent(earned, possible) >= sc.pass
+}
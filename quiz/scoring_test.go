@@ -0,0 +1,139 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// writeFile writes content to a temporary file called name.
+func writeFile(t *testing.T, name, content string) string {
+    t.Helper()
+    filename := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return filename
+}
+
+// loadFile writes content to a file called name and loads its problems.
+func loadFile(t *testing.T, name, content string) []Problem {
+    t.Helper()
+    src, err := openSource(writeFile(t, name, content), "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    problems, err := loadProblems(src, matchRule{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return problems
+}
+
+const scoringProblems = `
+- question: 5+5
+  answer: 10
+  points: 2
+- question: Pick the primes
+  options: [2, 4, 5, 9]
+  answer: A,C
+- question: Name the primary colors
+  type: parts
+  answer: [red, green, blue]
+- question: The sky is green
+  type: tf
+  answer: "false"
+`
+
+func TestGradeAndPoints(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", scoringProblems)
+    sc := scoring{negative: 0.5}
+    tests := []struct {
+        problem int
+        given   string
+        credit  float64
+        points  float64
+    }{
+        {0, "10", 1, 2},
+        {0, "11", 0, -1},
+        {0, "", 0, 0},
+        {0, "  ", 0, 0},
+        {1, "A,C", 1, 1},
+        {1, "AC", 1, 1},
+        {1, "A", 0.5, 0.5},
+        {1, "A,B", 0, -0.5},
+        {1, "A,B,C,D", 0, -0.5},
+        {2, "blue, red", 2.0 / 3, 2.0 / 3},
+        {2, "red; green; blue", 1, 1},
+        {2, "red, purple", 0, -0.5},
+        {3, "false", 1, 1},
+        {3, "B", 1, 1},
+        {3, "true", 0, -0.5},
+    }
+    for _, tt := range tests {
+        p := problems[tt.problem]
+        a := p.answer(tt.problem, tt.given)
+        if !near(a.credit, tt.credit) {
+            t.Errorf("%s = %q: got credit %v, want %v", p.q, tt.given, a.credit, tt.credit)
+        }
+        if a.isCorrect != (tt.credit == 1) {
+            t.Errorf("%s = %q: got correct %v", p.q, tt.given, a.isCorrect)
+        }
+        if got := sc.points(p, a); !near(got, tt.points) {
+            t.Errorf("%s = %q: got %v points, want %v", p.q, tt.given, got, tt.points)
+        }
+    }
+    timedOut := Answer{index: 0, timedOut: true}
+    if got := sc.points(problems[0], timedOut); got != 0 {
+        t.Errorf("timed out answer: got %v points, want 0", got)
+    }
+}
+
+func TestResultsPoints(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", scoringProblems)
+    sc := scoring{negative: 1, pass: 50}
+    var res Results
+    res.add(problems[0].answer(0, "10"))
+    res.add(problems[1].answer(1, "B"))
+    earned, possible := res.points(problems, sc)
+    if earned != 1 || possible != 5 {
+        t.Errorf("got %v out of %v, want 1 out of 5", earned, possible)
+    }
+    if sc.passed(earned, possible) {
+        t.Errorf("20%% passed a 50%% pass mark")
+    }
+}
+
+func TestGradeSheetSkipsBlankAnswers(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", scoringProblems)
+    sheet := writeFile(t, "answers.csv", "5+5,\nThe sky is green,false\n")
+    res, err := gradeSheet(sheet, problems)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.answered != 1 || res.correct != 1 {
+        t.Errorf("got %d answered, %d correct, want 1 and 1", res.answered, res.correct)
+    }
+    earned, _ := res.points(problems, scoring{negative: 0.5})
+    if earned != 1 {
+        t.Errorf("got %v points, want 1: the blank answer shouldn't cost anything", earned)
+    }
+}
+
+func TestSessionSkipsBlankAnswers(t *testing.T) {
+    problems := loadFile(t, "problems.yaml", scoringProblems)
+    sess := &session{problems: problems, scoring: scoring{negative: 1}, res: Results{total: len(problems)}}
+    sess.question(time.Now())
+    if _, err := sess.answer("", time.Now()); err != nil {
+        t.Fatal(err)
+    }
+    if sess.next != 1 || len(sess.res.answers) != 0 {
+        t.Errorf("blank answer: got next %d and %d answers, want 1 and 0", sess.next, len(sess.res.answers))
+    }
+}
+
+func near(a, b float64) bool {
+    d := a - b
+    return d < 1e-9 && d > -1e-9
+}
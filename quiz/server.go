@@ -0,0 +1,370 @@
+package main
+
+import (
+    "crypto/rand"
+    _ "embed"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    mrand "math/rand"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+//go:embed serve.html
+var servePage []byte
+
+// server runs quizzes over http, one session per quiz taker.
+//
+// All timing happens on the server: a question's clock starts when it is
+// fetched and answers arriving after its deadline (or the session's) are
+// counted as timed out, whatever the client's clock says.
+//
+//     GET  /                           the quiz page
+//     POST /api/sessions               {"user": ...} -> session
+//     GET  /api/sessions/<id>/question next question (starts its clock)
+//     POST /api/sessions/<id>/answer   {"answer": ...}, option labels for choice questions
+//     GET  /api/sessions/<id>/results  results once the quiz is over
+type server struct {
+    problems []Problem
+    order    ordering
+    limit    time.Duration // for the whole quiz, 0 for none
+    perLimit time.Duration // per question, unless a problem sets its own
+    source   string        // runs are recorded to the history when set
+    scoring  scoring
+
+    now      func() time.Time
+
+    mu        sync.Mutex
+    rng       *mrand.Rand
+    sessions  map[string]*session
+    lastSweep time.Time
+}
+
+const (
+    // sessions are dropped this long after they started
+    sessionTTL = 24 * time.Hour
+    // expired sessions are looked for at most this often
+    sweepInterval = time.Minute
+    // new sessions are refused while this many are going
+    maxSessions = 10000
+)
+
+func newServer(problems []Problem, order ordering, rng *mrand.Rand) *server {
+    return &server{
+        problems: problems,
+        order:    order,
+        now:      time.Now,
+        rng:      rng,
+        sessions: make(map[string]*session),
+    }
+}
+
+type session struct {
+    id       string
+    user     string
+    problems []Problem
+    started  time.Time
+    deadline time.Time // zero for no limit
+    perLimit time.Duration
+    scoring  scoring
+    next     int       // index of the current question
+    shown    time.Time // when the current question was fetched, zero if it wasn't
+    res      Results
+    recorded bool
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path == "/" {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Write(servePage)
+        return
+    }
+    if r.URL.Path == "/api/sessions" {
+        s.create(w, r)
+        return
+    }
+    // /api/sessions/<id>/<action>
+    rest := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+    id, action, found := strings.Cut(rest, "/")
+    if rest == r.URL.Path || !found {
+        http.NotFound(w, r)
+        return
+    }
+
+    // the history is written once the lock is released, so other
+    // sessions don't wait for the disk
+    if run := s.serveSession(w, r, id, action); run != nil {
+        if err := recordRun(*run); err != nil {
+            log.Printf("failed to record run of session %s: %s\n", id, err)
+        }
+    }
+}
+
+// serveSession answers a request to session id. It returns the run to
+// record once a session's results are fetched the first time.
+func (s *server) serveSession(w http.ResponseWriter, r *http.Request, id, action string) *Run {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := s.now()
+    s.sweep(now)
+    sess, ok := s.sessions[id]
+    if !ok || sess.stale(now) {
+        jsonError(w, http.StatusNotFound, "no such session")
+        return nil
+    }
+    switch action {
+    case "question":
+        if r.Method != http.MethodGet {
+            jsonError(w, http.StatusMethodNotAllowed, "use GET")
+            return nil
+        }
+        writeJSON(w, http.StatusOK, sess.question(now))
+    case "answer":
+        if r.Method != http.MethodPost {
+            jsonError(w, http.StatusMethodNotAllowed, "use POST")
+            return nil
+        }
+        var body struct {
+            Answer string `json:"answer"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+            jsonError(w, http.StatusBadRequest, "invalid json")
+            return nil
+        }
+        a, err := sess.answer(body.Answer, now)
+        if err != nil {
+            jsonError(w, http.StatusConflict, err.Error())
+            return nil
+        }
+        writeJSON(w, http.StatusOK, map[string]bool{"timedOut": a.timedOut})
+    case "results":
+        if r.Method != http.MethodGet {
+            jsonError(w, http.StatusMethodNotAllowed, "use GET")
+            return nil
+        }
+        if !sess.done(now) {
+            jsonError(w, http.StatusConflict, "the quiz isn't over yet")
+            return nil
+        }
+        writeJSON(w, http.StatusOK, sess.results())
+        return s.finish(sess)
+    default:
+        http.NotFound(w, r)
+    }
+    return nil
+}
+
+// sweep drops expired sessions, at most every sweepInterval. s.mu must
+// be held.
+func (s *server) sweep(now time.Time) {
+    if now.Sub(s.lastSweep) < sweepInterval {
+        return
+    }
+    s.lastSweep = now
+    for id, sess := range s.sessions {
+        if sess.stale(now) {
+            delete(s.sessions, id)
+        }
+    }
+}
+
+// stale reports whether the session is past sessionTTL.
+func (sess *session) stale(now time.Time) bool {
+    return now.Sub(sess.started) > sessionTTL
+}
+
+// create starts a new session with its own order of the problems.
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        jsonError(w, http.StatusMethodNotAllowed, "use POST")
+        return
+    }
+    var body struct {
+        User string `json:"user"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+        jsonError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    id, err := newSessionID()
+    if err != nil {
+        jsonError(w, http.StatusInternalServerError, "failed to create session")
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := s.now()
+    s.sweep(now)
+    if len(s.sessions) >= maxSessions {
+        jsonError(w, http.StatusServiceUnavailable, "too many quizzes going, try again later")
+        return
+    }
+    problems := s.order.sample(s.order.shuffled(s.problems, s.rng), s.rng)
+    sess := &session{
+        id:       id,
+        user:     strings.TrimSpace(body.User),
+        problems: problems,
+        started:  now,
+        perLimit: s.perLimit,
+        scoring:  s.scoring,
+        res:      Results{total: len(problems)},
+    }
+    if s.limit > 0 {
+        sess.deadline = now.Add(s.limit)
+    }
+    s.sessions[id] = sess
+    writeJSON(w, http.StatusCreated, map[string]any{
+        "id":        id,
+        "total":     len(problems),
+        "remaining": seconds(sess.deadline, now),
+    })
+}
+
+// finish returns the run of a finished session for the history, once.
+// s.mu must be held.
+func (s *server) finish(sess *session) *Run {
+    if s.source == "" || sess.recorded {
+        return nil
+    }
+    sess.recorded = true
+    run := newRun(sess.user, s.source, sess.started, sess.problems, sess.res)
+    return &run
+}
+
+// questionDeadline is when the current question times out, zero if it
+// has no limit.
+func (sess *session) questionDeadline() time.Time {
+    deadline := sess.deadline
+    if limit := sess.problems[sess.next].timeLimit(sess.perLimit); limit > 0 {
+        d := sess.shown.Add(limit)
+        if deadline.IsZero() || d.Before(deadline) {
+            deadline = d
+        }
+    }
+    return deadline
+}
+
+// expired reports whether the clock of the current question ran out.
+func (sess *session) expired(now time.Time) bool {
+    d := sess.questionDeadline()
+    return !d.IsZero() && now.After(d)
+}
+
+func (sess *session) done(now time.Time) bool {
+    return sess.next >= len(sess.problems) || (!sess.deadline.IsZero() && now.After(sess.deadline))
+}
+
+// question returns the current question, starting its clock the first
+// time it's fetched. A question whose clock already ran out is counted
+// as timed out and the next one is returned instead.
+func (sess *session) question(now time.Time) map[string]any {
+    if !sess.shown.IsZero() && !sess.done(now) && sess.expired(now) {
+        sess.res.add(Answer{index: sess.next, timedOut: true, latency: now.Sub(sess.shown)})
+        sess.next++
+        sess.shown = time.Time{}
+    }
+    if sess.done(now) {
+        return map[string]any{"done": true}
+    }
+    if sess.shown.IsZero() {
+        sess.shown = now
+    }
+    p := sess.problems[sess.next]
+    options := make([]map[string]string, len(p.options))
+    for i, o := range p.options {
+        options[i] = map[string]string{"label": label(i), "text": o}
+    }
+    return map[string]any{
+        "done":      false,
+        "index":     sess.next + 1,
+        "total":     len(sess.problems),
+        "question":  p.q,
+        "type":      p.kind.String(),
+        "options":   options,
+        "remaining": seconds(sess.questionDeadline(), now),
+    }
+}
+
+// answer grades the answer to the current question and moves on. An
+// empty answer skips the question.
+func (sess *session) answer(given string, now time.Time) (Answer, error) {
+    if sess.done(now) {
+        return Answer{}, fmt.Errorf("the quiz is over")
+    }
+    if sess.shown.IsZero() {
+        return Answer{}, fmt.Errorf("fetch the question before answering it")
+    }
+    p := sess.problems[sess.next]
+    a := Answer{index: sess.next, timedOut: true}
+    if !sess.expired(now) {
+        a = p.answer(sess.next, given)
+    }
+    a.latency = now.Sub(sess.shown)
+    if a.timedOut || !skipped(given) {
+        sess.res.add(a)
+    }
+    sess.next++
+    sess.shown = time.Time{}
+    return a, nil
+}
+
+func (sess *session) results() map[string]any {
+    res := sess.res
+    questions := make([]map[string]any, len(res.answers))
+    for i, a := range res.answers {
+        questions[i] = map[string]any{
+            "question": sess.problems[a.index].q,
+            "correct":  a.isCorrect,
+            "credit":   a.credit,
+            "timedOut": a.timedOut,
+        }
+    }
+    earned, possible := res.points(sess.problems, sess.scoring)
+    results := map[string]any{
+        "correct":   res.correct,
+        "answered":  res.answered,
+        "total":     res.total,
+        "points":    earned,
+        "possible":  possible,
+        "questions": questions,
+    }
+    if sess.scoring.pass > 0 {
+        results["passed"] = sess.scoring.passed(earned, possible)
+    }
+    return results
+}
+
+// seconds left until deadline, nil (null in json) if there is none.
+func seconds(deadline, now time.Time) any {
+    if deadline.IsZero() {
+        return nil
+    }
+    left := deadline.Sub(now).Seconds()
+    if left < 0 {
+        left = 0
+    }
+    return left
+}
+
+func newSessionID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func jsonError(w http.ResponseWriter, status int, msg string) {
+    writeJSON(w, status, map[string]string{"error": msg})
+}
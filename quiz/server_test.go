@@ -0,0 +1,165 @@
+package main
+
+import (
+    "encoding/json"
+    mrand "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// testServer is a server on a clock the test moves.
+type testServer struct {
+    t     *testing.T
+    srv   *server
+    clock time.Time
+}
+
+func newTestServer(t *testing.T, problems []Problem) *testServer {
+    ts := &testServer{t: t, clock: time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)}
+    ts.srv = newServer(problems, ordering{}, mrand.New(mrand.NewSource(1)))
+    ts.srv.now = func() time.Time { return ts.clock }
+    return ts
+}
+
+func (ts *testServer) do(method, path, body string) (int, map[string]any) {
+    ts.t.Helper()
+    w := httptest.NewRecorder()
+    ts.srv.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+    var v map[string]any
+    if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+        ts.t.Fatalf("%s %s: %s", method, path, err)
+    }
+    return w.Code, v
+}
+
+func (ts *testServer) start() string {
+    ts.t.Helper()
+    status, v := ts.do("POST", "/api/sessions", `{"user": "ann"}`)
+    if status != http.StatusCreated {
+        ts.t.Fatalf("create: got status %d: %v", status, v)
+    }
+    return v["id"].(string)
+}
+
+func (ts *testServer) answer(id, given string) bool {
+    ts.t.Helper()
+    status, v := ts.do("POST", "/api/sessions/"+id+"/answer", `{"answer": "`+given+`"}`)
+    if status != http.StatusOK {
+        ts.t.Fatalf("answer: got status %d: %v", status, v)
+    }
+    return v["timedOut"].(bool)
+}
+
+func TestServerQuestionLimits(t *testing.T) {
+    ts := newTestServer(t, arithmetic("2", "4", "6"))
+    ts.srv.perLimit = 10 * time.Second
+    id := ts.start()
+
+    _, q := ts.do("GET", "/api/sessions/"+id+"/question", "")
+    if q["index"] != 1.0 || q["remaining"] != 10.0 {
+        t.Fatalf("first question: got %v", q)
+    }
+    ts.clock = ts.clock.Add(11 * time.Second)
+    if !ts.answer(id, "2") {
+        t.Error("an answer after the question's limit isn't timed out")
+    }
+
+    ts.do("GET", "/api/sessions/"+id+"/question", "")
+    ts.clock = ts.clock.Add(4 * time.Second)
+    // fetching again doesn't restart the clock
+    if _, q := ts.do("GET", "/api/sessions/"+id+"/question", ""); q["index"] != 2.0 || q["remaining"] != 6.0 {
+        t.Errorf("second question fetched again: got %v", q)
+    }
+    if ts.answer(id, "4") {
+        t.Error("an answer in time is timed out")
+    }
+
+    // a question left alone past its limit is skipped when fetching
+    ts.do("GET", "/api/sessions/"+id+"/question", "")
+    ts.clock = ts.clock.Add(time.Minute)
+    if _, q := ts.do("GET", "/api/sessions/"+id+"/question", ""); q["done"] != true {
+        t.Errorf("after the last question ran out: got %v", q)
+    }
+    status, res := ts.do("GET", "/api/sessions/"+id+"/results", "")
+    if status != http.StatusOK || res["correct"] != 1.0 || res["answered"] != 1.0 || res["total"] != 3.0 {
+        t.Errorf("results: got %d %v", status, res)
+    }
+}
+
+func TestServerQuizLimit(t *testing.T) {
+    ts := newTestServer(t, arithmetic("2", "4"))
+    ts.srv.limit = 30 * time.Second
+    id := ts.start()
+    ts.do("GET", "/api/sessions/"+id+"/question", "")
+    if status, _ := ts.do("GET", "/api/sessions/"+id+"/results", ""); status != http.StatusConflict {
+        t.Errorf("results before the end: got status %d", status)
+    }
+    ts.clock = ts.clock.Add(31 * time.Second)
+    if status, v := ts.do("POST", "/api/sessions/"+id+"/answer", `{"answer": "2"}`); status != http.StatusConflict {
+        t.Errorf("answer after the quiz ended: got %d %v", status, v)
+    }
+    if _, q := ts.do("GET", "/api/sessions/"+id+"/question", ""); q["done"] != true {
+        t.Errorf("question after the quiz ended: got %v", q)
+    }
+    if status, res := ts.do("GET", "/api/sessions/"+id+"/results", ""); status != http.StatusOK || res["answered"] != 0.0 {
+        t.Errorf("results: got %d %v", status, res)
+    }
+}
+
+func TestServerSessionExpiry(t *testing.T) {
+    ts := newTestServer(t, arithmetic("2"))
+    old := ts.start()
+    ts.clock = ts.clock.Add(sessionTTL - time.Hour)
+    recent := ts.start()
+    ts.clock = ts.clock.Add(2 * time.Hour)
+    if status, _ := ts.do("GET", "/api/sessions/"+old+"/question", ""); status != http.StatusNotFound {
+        t.Errorf("expired session: got status %d", status)
+    }
+    if status, _ := ts.do("GET", "/api/sessions/"+recent+"/question", ""); status != http.StatusOK {
+        t.Errorf("live session: got status %d", status)
+    }
+    // swept on a request, not only when a session is created
+    if _, ok := ts.srv.sessions[old]; ok {
+        t.Error("expired session is still kept")
+    }
+
+    for i := len(ts.srv.sessions); i < maxSessions; i++ {
+        ts.srv.sessions[string(rune(i))] = &session{started: ts.clock}
+    }
+    if status, _ := ts.do("POST", "/api/sessions", `{"user": "bo"}`); status != http.StatusServiceUnavailable {
+        t.Errorf("create with %d sessions going: got status %d", maxSessions, status)
+    }
+    ts.clock = ts.clock.Add(sessionTTL + time.Minute)
+    if status, _ := ts.do("POST", "/api/sessions", `{"user": "bo"}`); status != http.StatusCreated {
+        t.Errorf("create once the sessions expired: got status %d", status)
+    }
+}
+
+func TestServerRecordsOnce(t *testing.T) {
+    t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+    ts := newTestServer(t, arithmetic("2"))
+    ts.srv.source = "test"
+    id := ts.start()
+    ts.do("GET", "/api/sessions/"+id+"/question", "")
+    ts.answer(id, "2")
+    for i := 0; i < 2; i++ {
+        if status, _ := ts.do("GET", "/api/sessions/"+id+"/results", ""); status != http.StatusOK {
+            t.Fatalf("results: got status %d", status)
+        }
+    }
+    h, err := OpenHistory()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer h.Close()
+    runs, err := h.Runs()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(runs) != 1 || runs[0].User != "ann" || runs[0].Source != "test" {
+        t.Errorf("got runs %+v, want one of ann", runs)
+    }
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// ProblemSource is anything problems can be loaded from.
+//
+// Sources only deal with getting raw Records out of their format, every
+// format then shares the same conversion (and error reporting) in
+// loadProblems.
+type ProblemSource interface {
+    Records() ([]Record, error)
+}
+
+// Record is a single problem as read from a source, before validation.
+// Fields holds the raw key/value pairs (question, answer, category, ...)
+// and Pos is a "file:line" position used in error messages. Err is set
+// for a problem the source couldn't read, so the records after it can
+// still be checked.
+type Record struct {
+    Fields map[string]any
+    Pos    string
+    Err    error
+}
+
+// supported problem file formats
+const (
+    csvFormat  = "csv"
+    jsonFormat = "json"
+    yamlFormat = "yaml"
+    textFormat = "text"
+)
+
+var formatsByExt = map[string]string{
+    ".csv":  csvFormat,
+    ".json": jsonFormat,
+    ".yaml": yamlFormat,
+    ".yml":  yamlFormat,
+    ".txt":  textFormat,
+}
+
+// openSource returns the ProblemSource for filename. format overrides
+// the format implied by the file extension when non empty.
+func openSource(filename, format string) (ProblemSource, error) {
+    if format == "" {
+        ext := strings.ToLower(filepath.Ext(filename))
+        f, ok := formatsByExt[ext]
+        if !ok {
+            return nil, fmt.Errorf("can't tell the format of %s. Use -format to pick one of csv, json, yaml or text.", filename)
+        }
+        format = f
+    }
+    switch format {
+    case csvFormat:
+        return csvSource{filename}, nil
+    case jsonFormat:
+        return jsonSource{filename}, nil
+    case yamlFormat, "yml":
+        return yamlSource{filename}, nil
+    case textFormat, "txt":
+        return textSource{filename}, nil
+    default:
+        return nil, fmt.Errorf("unknown format %q. Must be csv, json, yaml or text.", format)
+    }
+}
+
+// csvSource reads rows of
+// question, answer[, category, difficulty, points, match, time, type, options].
+// If the first row is a header (its first cell is "question") columns
+// are matched by name instead and may come in any order.
+type csvSource struct {
+    filename string
+}
+
+var csvColumns = []string{"question", "answer", "category", "difficulty", "points", "match", "time", "type", "options"}
+
+func (s csvSource) Records() ([]Record, error) {
+    b, err := os.ReadFile(s.filename)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to open file: %s!", s.filename)
+    }
+    r := csv.NewReader(bytes.NewReader(b))
+    r.FieldsPerRecord = -1
+    r.TrimLeadingSpace = true
+
+    columns := csvColumns
+    records := make([]Record, 0)
+    for first := true; ; first = false {
+        row, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        var perr *csv.ParseError
+        if errors.As(err, &perr) {
+            // the reader goes on with the next row
+            records = append(records, Record{Pos: pos(s.filename, perr.StartLine), Err: perr.Err})
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", s.filename, err)
+        }
+        line, _ := r.FieldPos(0)
+        if first && strings.EqualFold(strings.TrimSpace(row[0]), "question") {
+            columns = make([]string, len(row))
+            for i, col := range row {
+                columns[i] = strings.ToLower(strings.TrimSpace(col))
+            }
+            continue
+        }
+        if len(row) > len(columns) {
+            err := fmt.Errorf("row has %d columns, expected at most %d", len(row), len(columns))
+            records = append(records, Record{Pos: pos(s.filename, line), Err: err})
+            continue
+        }
+        fields := make(map[string]any)
+        for i, cell := range row {
+            fields[columns[i]] = cell
+        }
+        records = append(records, Record{Fields: fields, Pos: pos(s.filename, line)})
+    }
+    return records, nil
+}
+
+// jsonSource reads a top level array of problem objects.
+//
+//     [{"question": "5+5", "answer": "10", "category": "math"}]
+type jsonSource struct {
+    filename string
+}
+
+func (s jsonSource) Records() ([]Record, error) {
+    b, err := os.ReadFile(s.filename)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to open file: %s!", s.filename)
+    }
+    d := json.NewDecoder(bytes.NewReader(b))
+    // numbers stay as written, 1000000 rather than a float64
+    d.UseNumber()
+    if t, err := d.Token(); err != nil || t != json.Delim('[') {
+        return nil, fmt.Errorf("%s: expected a list of problems", s.filename)
+    }
+    records := make([]Record, 0)
+    for d.More() {
+        // offset of the next value, so errors can point at a line
+        start := d.InputOffset()
+        at := pos(s.filename, lineAt(b, start))
+        var fields map[string]any
+        err := d.Decode(&fields)
+        var terr *json.UnmarshalTypeError
+        if errors.As(err, &terr) {
+            // the value was read, only it isn't an object
+            records = append(records, Record{Pos: at, Err: fmt.Errorf("expected a problem, got a %s", terr.Value)})
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", at, err)
+        }
+        records = append(records, Record{Fields: fields, Pos: at})
+    }
+    return records, nil
+}
+
+// lineAt returns the line of the first non space byte at or after offset.
+func lineAt(b []byte, offset int64) int {
+    i := int(offset)
+    for i < len(b) && strings.ContainsRune(" \t\r\n,", rune(b[i])) {
+        i++
+    }
+    return bytes.Count(b[:i], []byte("\n")) + 1
+}
+
+// yamlSource reads a top level sequence of problem mappings.
+//
+//     - question: 5+5
+//       answer: 10
+type yamlSource struct {
+    filename string
+}
+
+func (s yamlSource) Records() ([]Record, error) {
+    b, err := os.ReadFile(s.filename)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to open file: %s!", s.filename)
+    }
+    var nodes []yaml.Node
+    if err := yaml.Unmarshal(b, &nodes); err != nil {
+        return nil, fmt.Errorf("%s: %w", s.filename, err)
+    }
+    records := make([]Record, len(nodes))
+    for i, n := range nodes {
+        records[i].Pos = pos(s.filename, n.Line)
+        if n.Kind != yaml.MappingNode {
+            records[i].Err = fmt.Errorf("expected a problem, got %q", n.Value)
+            continue
+        }
+        records[i].Err = n.Decode(&records[i].Fields)
+    }
+    return records, nil
+}
+
+// textSource reads problems written as "Key: value" lines. Every problem
+// starts with a Q: line, the lines after it (A:, Category:, ...) belong to
+// it. Options of a choice question are listed as "A) option" lines.
+// Blank lines and lines starting with # are ignored.
+//
+//     Q: 5+5
+//     A: 10
+//
+//     Q: The capital of France
+//     A) London
+//     B) Paris
+//     A: B
+type textSource struct {
+    filename string
+}
+
+// "B) Paris", an option of a choice question
+var optionLine = regexp.MustCompile(`^[A-Za-z]\)\s*(.*)$`)
+
+var textKeys = map[string]string{
+    "q": "question",
+    "a": "answer",
+}
+
+func (s textSource) Records() ([]Record, error) {
+    f, err := os.Open(s.filename)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to open file: %s!", s.filename)
+    }
+    defer f.Close()
+
+    records := make([]Record, 0)
+    sc := bufio.NewScanner(f)
+    for line := 1; sc.Scan(); line++ {
+        text := strings.TrimSpace(sc.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        key, value, ok := strings.Cut(text, ":")
+        key = strings.ToLower(strings.TrimSpace(key))
+        if k, ok := textKeys[key]; ok {
+            key = k
+        }
+        isQuestion := ok && key == "question"
+        // everything before the first Q: line is reported once, as the
+        // line it starts at
+        if !isQuestion && len(records) > 0 && records[len(records)-1].Fields == nil {
+            continue
+        }
+        if m := optionLine.FindStringSubmatch(text); m != nil && len(records) > 0 {
+            fields := records[len(records)-1].Fields
+            options, _ := fields["options"].([]any)
+            fields["options"] = append(options, m[1])
+            continue
+        }
+        switch {
+        case isQuestion:
+            records = append(records, Record{Fields: make(map[string]any), Pos: pos(s.filename, line)})
+        case len(records) == 0:
+            records = append(records, Record{Pos: pos(s.filename, line), Err: fmt.Errorf("%q before the first Q: line", text)})
+            continue
+        case !ok:
+            // the problem the line is in is reported, at the line
+            if last := &records[len(records)-1]; last.Err == nil {
+                last.Pos = pos(s.filename, line)
+                last.Err = fmt.Errorf("expected a \"Key: value\" line")
+            }
+            continue
+        }
+        records[len(records)-1].Fields[key] = strings.TrimSpace(value)
+    }
+    if err := sc.Err(); err != nil {
+        return nil, fmt.Errorf("Something went wrong reading %s.", s.filename)
+    }
+    return records, nil
+}
+
+func pos(filename string, line int) string {
+    return fmt.Sprintf("%s:%d", filename, line)
+}
+
+// loadProblems reads every record in src and converts it to a Problem.
+// match is used for problems that don't set their own match rule.
+func loadProblems(src ProblemSource, match matchRule) ([]Problem, error) {
+    records, err := src.Records()
+    if err != nil {
+        return nil, err
+    }
+    problems := make([]Problem, len(records))
+    for i, rec := range records {
+        p, err := rec.problem(match)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", rec.Pos, err)
+        }
+        problems[i] = p
+    }
+    return problems, nil
+}
+
+func (rec Record) problem(match matchRule) (Problem, error) {
+    if rec.Err != nil {
+        return Problem{pos: rec.Pos}, rec.Err
+    }
+    p := Problem{
+        q:        rec.str("question"),
+        category: rec.str("category"),
+        points:   1,
+        match:    match,
+        pos:      rec.Pos,
+    }
+    if p.q == "" {
+        return p, fmt.Errorf("missing question")
+    }
+    if d := rec.str("difficulty"); d != "" {
+        n, err := parseDifficulty(d)
+        if err != nil {
+            return p, err
+        }
+        p.difficulty = n
+    }
+    if pts := rec.str("points"); pts != "" {
+        n, err := strconv.ParseFloat(pts, 64)
+        if err != nil || n < 0 {
+            return p, fmt.Errorf("invalid points %q", pts)
+        }
+        p.points = n
+    }
+    if t := rec.str("time"); t != "" {
+        limit, err := parseLimit(t)
+        if err != nil {
+            return p, err
+        }
+        p.limit = limit
+    }
+    if spec := rec.str("match"); spec != "" {
+        m, err := parseMatchRule(spec)
+        if err != nil {
+            return p, err
+        }
+        p.match = m
+    }
+    // "|" is regex alternation, so regex answers are never split
+    p.answers = rec.answers(!p.match.regex)
+    if len(p.answers) == 0 {
+        return p, fmt.Errorf("missing answer")
+    }
+    options := rec.list("options")
+    kind, ok := kindNames[strings.ToLower(rec.str("type"))]
+    switch {
+    case !ok:
+        return p, fmt.Errorf("unknown question type %q. Must be free, choice, tf, multi or parts.", rec.str("type"))
+    case rec.str("type") == "" && len(options) > 0 && (len(p.answers) > 1 || strings.Contains(p.answers[0], ",")):
+        // several answers, or labels like "A,C"
+        kind = multiSelect
+    case rec.str("type") == "" && len(options) > 0:
+        kind = singleChoice
+    }
+    p.kind = kind
+    if p.kind.choice() {
+        if err := p.setChoices(options); err != nil {
+            return p, err
+        }
+        return p, nil
+    }
+    if len(options) > 0 {
+        return p, fmt.Errorf("%s questions can't have options", p.kind)
+    }
+    patterns, err := p.match.compile(p.answers)
+    if err != nil {
+        return p, err
+    }
+    p.patterns = patterns
+    return p, nil
+}
+
+// answers returns the accepted answers of the record. They're either a
+// list (json, yaml) or a single value with alternatives separated by "|"
+// when split is set. "answers" may be used in place of "answer".
+func (rec Record) answers(split bool) []string {
+    v, ok := rec.Fields["answer"]
+    if !ok {
+        v = rec.Fields["answers"]
+    }
+    return splitList(v, split)
+}
+
+// list returns field key as a list of text, see answers.
+func (rec Record) list(key string) []string {
+    return splitList(rec.Fields[key], true)
+}
+
+// splitList turns a list value (json, yaml) or, when split is set, a
+// single value separated by "|" into a list of non empty strings.
+func splitList(v any, split bool) []string {
+    var raw []string
+    switch v := v.(type) {
+    case nil:
+    case []any:
+        for _, a := range v {
+            raw = append(raw, text(a))
+        }
+    default:
+        raw = []string{text(v)}
+        if split {
+            raw = strings.Split(raw[0], "|")
+        }
+    }
+    list := make([]string, 0, len(raw))
+    for _, a := range raw {
+        if a = strings.TrimSpace(a); a != "" {
+            list = append(list, a)
+        }
+    }
+    return list
+}
+
+// str returns field key as trimmed text, or "" if it isn't set.
+func (rec Record) str(key string) string {
+    v, ok := rec.Fields[key]
+    if !ok || v == nil {
+        return ""
+    }
+    return strings.TrimSpace(text(v))
+}
+
+// text is a field value as written. Numbers from yaml are float64 or
+// int, and a float64 is written out in full: 1000000, not 1e+06. json
+// numbers are kept as written, see jsonSource.
+func text(v any) string {
+    if f, ok := v.(float64); ok {
+        return strconv.FormatFloat(f, 'f', -1, 64)
+    }
+    return fmt.Sprint(v)
+}
+
+var difficulties = map[string]int{
+    "easy":   1,
+    "medium": 2,
+    "hard":   3,
+}
+
+// parseDifficulty accepts easy, medium, hard or a positive integer.
+func parseDifficulty(s string) (int, error) {
+    if n, ok := difficulties[strings.ToLower(s)]; ok {
+        return n, nil
+    }
+    n, err := strconv.Atoi(s)
+    if err != nil || n < 1 {
+        return 0, fmt.Errorf("invalid difficulty %q. Must be easy, medium, hard or a positive number.", s)
+    }
+    return n, nil
+}
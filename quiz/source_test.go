@@ -0,0 +1,185 @@
+package main
+
+import (
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// the same problems in every format
+var sameProblems = map[string]string{
+    "problems.csv": `question,answer,category,difficulty,points,match,time,type,options
+5+5,10|ten,math,easy,2,,30s,,
+The capital of France,B,geo,,,,,,London|Paris|Rome
+Pick the primes,"A,C",math,3,,,,,2|4|5
+Spell Mississippi,Mississippi,,,,"case,fuzzy",,,
+`,
+    "reordered.csv": `question,options,type,answer,category,difficulty,points,match,time
+5+5,,,10|ten,math,easy,2,,30s
+The capital of France,London|Paris|Rome,,B,geo,,,,
+Pick the primes,2|4|5,,"A,C",math,3,,,
+Spell Mississippi,,,Mississippi,,,,"case,fuzzy",
+`,
+    "problems.json": `[
+  {"question": "5+5", "answer": ["10", "ten"], "category": "math", "difficulty": "easy", "points": 2, "time": "30s"},
+  {"question": "The capital of France", "answer": "B", "category": "geo", "options": ["London", "Paris", "Rome"]},
+  {"question": "Pick the primes", "answer": "A,C", "category": "math", "difficulty": 3, "options": [2, 4, 5]},
+  {"question": "Spell Mississippi", "answer": "Mississippi", "match": "case,fuzzy"}
+]`,
+    "problems.yaml": `
+- question: 5+5
+  answer: [10, ten]
+  category: math
+  difficulty: easy
+  points: 2
+  time: 30
+- question: The capital of France
+  answer: B
+  category: geo
+  options: [London, Paris, Rome]
+- question: Pick the primes
+  answer: [A, C]
+  category: math
+  difficulty: 3
+  options: [2, 4, 5]
+- question: Spell Mississippi
+  answer: Mississippi
+  match: case,fuzzy
+`,
+    "problems.txt": `# a comment
+Q: 5+5
+A: 10|ten
+Category: math
+Difficulty: easy
+Points: 2
+Time: 30s
+
+Q: The capital of France
+A) London
+B) Paris
+C) Rome
+A: B
+Category: geo
+
+Q: Pick the primes
+a) 2
+b) 4
+c) 5
+A: A,C
+Category: math
+Difficulty: 3
+
+Q: Spell Mississippi
+A: Mississippi
+Match: case,fuzzy
+`,
+}
+
+func TestLoadProblemsFormats(t *testing.T) {
+    fuzzy := matchRule{fold: true, fuzzy: 1}
+    want := []Problem{
+        {q: "5+5", answers: []string{"10", "ten"}, category: "math", difficulty: 1, points: 2, limit: 30 * time.Second},
+        {q: "The capital of France", answers: []string{"Paris"}, category: "geo", points: 1, kind: singleChoice, options: []string{"London", "Paris", "Rome"}},
+        {q: "Pick the primes", answers: []string{"2", "5"}, category: "math", difficulty: 3, points: 1, kind: multiSelect, options: []string{"2", "4", "5"}},
+        {q: "Spell Mississippi", answers: []string{"Mississippi"}, points: 1, match: fuzzy},
+    }
+    for name, content := range sameProblems {
+        problems := loadFile(t, name, content)
+        if len(problems) != len(want) {
+            t.Errorf("%s: got %d problems, want %d", name, len(problems), len(want))
+            continue
+        }
+        for i, p := range problems {
+            if !strings.HasSuffix(p.pos, name+":"+lineOf(content, want[i].q)) {
+                t.Errorf("%s: problem %d is at %s", name, i+1, p.pos)
+            }
+            p.pos = ""
+            if !reflect.DeepEqual(p, want[i]) {
+                t.Errorf("%s: problem %d:\ngot  %+v\nwant %+v", name, i+1, p, want[i])
+            }
+        }
+    }
+}
+
+// lineOf returns the line number of the first line with q on it.
+func lineOf(content, q string) string {
+    for i, line := range strings.Split(content, "\n") {
+        if strings.Contains(line, q) {
+            return strconv.Itoa(i + 1)
+        }
+    }
+    return "?"
+}
+
+func TestLoadProblemsErrors(t *testing.T) {
+    tests := []struct {
+        name, content, err string
+    }{
+        {"a.csv", "5+5\n", "a.csv:1: missing answer"},
+        {"a.csv", ",10\n", "a.csv:1: missing question"},
+        {"a.csv", "5+5,10\n6+6,12,math,extreme\n", "a.csv:2: invalid difficulty"},
+        {"a.csv", "5+5,10,,,-1\n", "a.csv:1: invalid points"},
+        {"a.csv", "5+5,10,,,,,soon\n", "a.csv:1: invalid time limit"},
+        {"a.csv", "5+5,10,,,,loose\n", "a.csv:1: unknown match mode"},
+        {"a.csv", "5+5,10,,,,,,essay\n", "a.csv:1: unknown question type"},
+        {"a.csv", "5+5,10,,,,,,,a|b\n", "a.csv:1: answer \"10\" is not one of the options"},
+        {"a.csv", "5+5,10,,,,,,free,a|b\n", "a.csv:1: free questions can't have options"},
+        {"a.csv", "5+5,(,,,,regex\n", "a.csv:1: invalid answer pattern"},
+        {"a.json", `{"question": "5+5"}`, "a.json: expected a list of problems"},
+        {"a.yaml", "- question: 5+5\n  answer: 10\n- question: 6+6\n", "a.yaml:3: missing answer"},
+        {"a.txt", "Q: 5+5\nA: 10\nQ: 6+6\n", "a.txt:3: missing answer"},
+    }
+    for _, tt := range tests {
+        src, err := openSource(writeFile(t, tt.name, tt.content), "")
+        if err != nil {
+            t.Fatal(err)
+        }
+        _, err = loadProblems(src, matchRule{})
+        if err == nil || !strings.Contains(err.Error(), tt.err) {
+            t.Errorf("%s %q: got error %v, want %q", tt.name, tt.content, err, tt.err)
+        }
+    }
+}
+
+func TestOpenSourceFormats(t *testing.T) {
+    if _, err := openSource("problems.xml", ""); err == nil {
+        t.Error("no error for an unknown extension")
+    }
+    if _, err := openSource("problems.xml", "toml"); err == nil {
+        t.Error("no error for an unknown format")
+    }
+    src, err := openSource("problems.xml", "yml")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := src.(yamlSource); !ok {
+        t.Errorf("-format yml opened a %T", src)
+    }
+}
+
+func TestLoadProblemsNumbers(t *testing.T) {
+    tests := []struct {
+        name, content string
+        want          []string
+    }{
+        {"a.json", `[{"question": "a million", "answer": 1000000}]`, []string{"1000000"}},
+        {"a.json", `[{"question": "big", "answer": [12345678.9, 0.0000001]}]`, []string{"12345678.9", "0.0000001"}},
+        {"a.yaml", "- question: a million\n  answer: 1000000\n", []string{"1000000"}},
+        {"a.yaml", "- question: big\n  answer: [12345678.9, 0.0000001]\n", []string{"12345678.9", "0.0000001"}},
+    }
+    for _, tt := range tests {
+        problems := loadFile(t, tt.name, tt.content)
+        if got := problems[0].answers; !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s %s: got answers %q, want %q", tt.name, tt.content, got, tt.want)
+        }
+        if !problems[0].accepts(tt.want[0]) {
+            t.Errorf("%s %s: %s isn't accepted", tt.name, tt.content, tt.want[0])
+        }
+    }
+    p := loadFile(t, "a.json", `[{"question": "q", "answer": "a", "points": 2.5, "difficulty": 2}]`)[0]
+    if p.points != 2.5 || p.difficulty != 2 {
+        t.Errorf("got points %v and difficulty %d, want 2.5 and 2", p.points, p.difficulty)
+    }
+}
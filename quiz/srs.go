@@ -0,0 +1,128 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// Leitner boxes for spaced repetition. Every problem starts in box 1, a
+// correct answer moves it up one box and a wrong answer sends it back to
+// box 1. The higher the box, the longer until the problem is due again.
+var boxIntervals = []time.Duration{
+    0,                   // box 1: every session
+    24 * time.Hour,      // box 2
+    3 * 24 * time.Hour,  // box 3
+    7 * 24 * time.Hour,  // box 4
+    14 * 24 * time.Hour, // box 5
+}
+
+// card is the repetition state of a single problem.
+type card struct {
+    Box  int
+    Seen time.Time
+}
+
+// leitner is one user's repetition state, keyed by question.
+type leitner struct {
+    path  string
+    Cards map[string]card
+}
+
+// openLeitner loads the state for user, starting empty if there is none.
+func openLeitner(user string) (*leitner, error) {
+    dir, err := appDir("srs")
+    if err != nil {
+        return nil, err
+    }
+    l := &leitner{
+        path:  filepath.Join(dir, user+".json"),
+        Cards: make(map[string]card),
+    }
+    b, err := os.ReadFile(l.path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return l, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(b, l); err != nil {
+        return nil, err
+    }
+    // the file may have been edited by hand, or written when there were
+    // more boxes
+    for q, c := range l.Cards {
+        switch {
+        case c.Box < 1:
+            c.Box = 1
+        case c.Box > len(boxIntervals):
+            c.Box = len(boxIntervals)
+        }
+        l.Cards[q] = c
+    }
+    return l, nil
+}
+
+func (l *leitner) Save() error {
+    b, err := json.MarshalIndent(l, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(l.path, b, 0600)
+}
+
+func (l *leitner) card(p Problem) card {
+    c, ok := l.Cards[p.q]
+    if !ok {
+        return card{Box: 1}
+    }
+    return c
+}
+
+// Due returns the problems due at now, lowest box (most often missed)
+// first. Problems in the same box keep their relative order.
+func (l *leitner) Due(problems []Problem, now time.Time) []Problem {
+    due := make([]Problem, 0)
+    for _, p := range problems {
+        c := l.card(p)
+        if !c.Seen.Add(boxIntervals[c.Box-1]).After(now) {
+            due = append(due, p)
+        }
+    }
+    sort.SliceStable(due, func(i, j int) bool {
+        return l.card(due[i]).Box < l.card(due[j]).Box
+    })
+    return due
+}
+
+// Update moves p up a box if it was answered correctly, back to box 1
+// otherwise.
+func (l *leitner) Update(p Problem, correct bool, now time.Time) {
+    c := l.card(p)
+    c.Seen = now
+    switch {
+    case !correct:
+        c.Box = 1
+    case c.Box < len(boxIntervals):
+        c.Box++
+    }
+    l.Cards[p.q] = c
+}
+
+// appDir returns (and creates) a directory for quiz's local state under
+// the user config directory.
+func appDir(elem ...string) (string, error) {
+    configDir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+    dir := filepath.Join(append([]string{configDir, "cli", "quiz"}, elem...)...)
+    if err := os.MkdirAll(dir, 0750); err != nil {
+        return "", err
+    }
+    return dir, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestOpenLeitnerClampsBoxes(t *testing.T) {
+    t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+    dir, err := appDir("srs")
+    if err != nil {
+        t.Fatal(err)
+    }
+    state := `{"Cards": {
+        "zero": {"Box": 0},
+        "negative": {"Box": -3},
+        "six": {"Box": 6, "Seen": "2024-01-01T00:00:00Z"}
+    }}`
+    if err := os.WriteFile(filepath.Join(dir, "ann.json"), []byte(state), 0600); err != nil {
+        t.Fatal(err)
+    }
+    l, err := openLeitner("ann")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]int{"zero": 1, "negative": 1, "six": len(boxIntervals)}
+    for q, box := range want {
+        if got := l.Cards[q].Box; got != box {
+            t.Errorf("%s: got box %d, want %d", q, got, box)
+        }
+    }
+    problems := []Problem{{q: "zero"}, {q: "negative"}, {q: "six"}, {q: "new"}}
+    now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+    if due := l.Due(problems, now); len(due) != 3 {
+        t.Errorf("got %d problems due, want 3", len(due))
+    }
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "sort"
+    "text/tabwriter"
+    "time"
+)
+
+// statsCmd implements `quiz stats`: a report on the runs in the history
+// store, optionally narrowed down to one user or problem file.
+func statsCmd(args []string) {
+    fs := flag.NewFlagSet("stats", flag.ExitOnError)
+    userName := fs.String("user", defaultUser(), "only include runs by this user, empty for everyone")
+    source := fs.String("file", "", "only include runs of this problem file. defaults to all files")
+    weeks := fs.Int("weeks", 8, "how many weeks of accuracy trend to show")
+    top := fs.Int("top", 5, "how many questions to list as slowest and most missed")
+    fs.Parse(args)
+    if *source != "" {
+        *source = sourceName(*source)
+    }
+
+    h, err := OpenHistory()
+    if err != nil {
+        exit(fmt.Sprintf("Failed to open history: %s", err))
+    }
+    defer h.Close()
+    all, err := h.Runs()
+    if err != nil {
+        exit(fmt.Sprintf("Failed to read history: %s", err))
+    }
+    runs := make([]Run, 0)
+    for _, run := range all {
+        if (*userName == "" || run.User == *userName) && (*source == "" || run.Source == *source) {
+            runs = append(runs, run)
+        }
+    }
+    if len(runs) == 0 {
+        fmt.Println("No runs recorded yet.")
+        return
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    defer w.Flush()
+
+    fmt.Fprintf(w, "%d runs, %s overall\n\n", len(runs), questions(runs))
+
+    fmt.Fprintln(w, "Accuracy by week")
+    for _, wk := range weekly(runs, *weeks) {
+        fmt.Fprintf(w, "  %s\t%d runs\t%s\n", wk.label, wk.runs, wk.tally)
+    }
+
+    stats := byQuestion(runs)
+
+    fmt.Fprintln(w, "\nSlowest questions (average time to answer)")
+    sort.SliceStable(stats, func(i, j int) bool {
+        return stats[i].avgLatency() > stats[j].avgLatency()
+    })
+    for _, q := range head(stats, *top) {
+        fmt.Fprintf(w, "  %s\t%s\n", q.question, q.avgLatency().Round(100*time.Millisecond))
+    }
+
+    fmt.Fprintln(w, "\nMost missed questions")
+    sort.SliceStable(stats, func(i, j int) bool {
+        return stats[i].missed() > stats[j].missed()
+    })
+    for _, q := range head(stats, *top) {
+        if q.missed() == 0 {
+            break
+        }
+        fmt.Fprintf(w, "  %s\tmissed %d of %d\n", q.question, q.missed(), q.asked)
+    }
+
+    fmt.Fprintln(w, "\nBy category")
+    for _, c := range byCategory(runs) {
+        fmt.Fprintf(w, "  %s\t%s\n", c.category, c.tally)
+    }
+}
+
+// tally counts correct answers out of questions asked.
+type tally struct {
+    correct int
+    asked   int
+}
+
+func (t tally) String() string {
+    if t.asked == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%d/%d (%.1f%%)", t.correct, t.asked, float64(t.correct)/float64(t.asked)*100)
+}
+
+func (t *tally) add(q QuestionResult) {
+    t.asked++
+    if q.Correct {
+        t.correct++
+    }
+}
+
+func questions(runs []Run) tally {
+    var t tally
+    for _, run := range runs {
+        for _, q := range run.Questions {
+            t.add(q)
+        }
+    }
+    return t
+}
+
+type week struct {
+    label string
+    runs  int
+    tally tally
+}
+
+// weekly groups runs by ISO week, returning the last n weeks that have
+// any runs oldest first. runs must be sorted oldest first.
+func weekly(runs []Run, n int) []week {
+    weeks := make([]week, 0)
+    for _, run := range runs {
+        y, wk := run.Time.ISOWeek()
+        label := fmt.Sprintf("%d-W%02d", y, wk)
+        if len(weeks) == 0 || weeks[len(weeks)-1].label != label {
+            weeks = append(weeks, week{label: label})
+        }
+        cur := &weeks[len(weeks)-1]
+        cur.runs++
+        for _, q := range run.Questions {
+            cur.tally.add(q)
+        }
+    }
+    if len(weeks) > n {
+        weeks = weeks[len(weeks)-n:]
+    }
+    return weeks
+}
+
+type questionStats struct {
+    question string
+    tally
+    answered int // asked and not timed out, latency is averaged over these
+    latency  time.Duration
+}
+
+func (q questionStats) missed() int {
+    return q.asked - q.correct
+}
+
+func (q questionStats) avgLatency() time.Duration {
+    if q.answered == 0 {
+        return 0
+    }
+    return q.latency / time.Duration(q.answered)
+}
+
+func byQuestion(runs []Run) []questionStats {
+    idx := make(map[string]int)
+    stats := make([]questionStats, 0)
+    for _, run := range runs {
+        for _, q := range run.Questions {
+            i, ok := idx[q.Question]
+            if !ok {
+                i = len(stats)
+                idx[q.Question] = i
+                stats = append(stats, questionStats{question: q.Question})
+            }
+            stats[i].add(q)
+            if !q.TimedOut {
+                stats[i].answered++
+                stats[i].latency += q.Latency
+            }
+        }
+    }
+    return stats
+}
+
+type categoryStats struct {
+    category string
+    tally    tally
+}
+
+// byCategory returns the tally of every category, sorted by name.
+// Problems without a category are grouped under "(none)".
+func byCategory(runs []Run) []categoryStats {
+    tallies := make(map[string]*tally)
+    for _, run := range runs {
+        for _, q := range run.Questions {
+            c := q.Category
+            if c == "" {
+                c = "(none)"
+            }
+            if tallies[c] == nil {
+                tallies[c] = &tally{}
+            }
+            tallies[c].add(q)
+        }
+    }
+    cats := make([]categoryStats, 0, len(tallies))
+    for c, t := range tallies {
+        cats = append(cats, categoryStats{c, *t})
+    }
+    sort.Slice(cats, func(i, j int) bool {
+        return cats[i].category < cats[j].category
+    })
+    return cats
+}
+
+func head(stats []questionStats, n int) []questionStats {
+    if n < len(stats) {
+        return stats[:n]
+    }
+    return stats
+}
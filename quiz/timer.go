@@ -0,0 +1,99 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// lineReader reads input lines on its own goroutine. Reads from a terminal
+// can't be interrupted, so instead of blocking in a read each question
+// waits on the lines channel and gives up when its context is done. A
+// line typed after a question timed out goes to the next question.
+type lineReader struct {
+    lines chan string
+    err   error // set before lines is closed
+}
+
+func newLineReader(r io.Reader) *lineReader {
+    lr := &lineReader{lines: make(chan string)}
+    go func() {
+        sc := bufio.NewScanner(r)
+        for sc.Scan() {
+            lr.lines <- sc.Text()
+        }
+        lr.err = sc.Err()
+        if lr.err == nil {
+            lr.err = io.EOF
+        }
+        close(lr.lines)
+    }()
+    return lr
+}
+
+// ReadLine returns the next line of input, or ctx.Err() if ctx is done
+// first.
+func (lr *lineReader) ReadLine(ctx context.Context) (string, error) {
+    select {
+    case line, ok := <-lr.lines:
+        if !ok {
+            return "", lr.err
+        }
+        return strings.TrimSpace(line), nil
+    case <-ctx.Done():
+        return "", ctx.Err()
+    }
+}
+
+// countdown keeps the "[12s]" in front of the current prompt up to date
+// until ctx is done. It only redraws when stdout is a terminal, since the
+// escape codes would end up as garbage in a pipe or file.
+func countdown(ctx context.Context, deadline time.Time) {
+    if !isTerminal(os.Stdout) {
+        return
+    }
+    t := time.NewTicker(time.Second)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+            // save cursor, rewrite the start of the line, restore cursor
+            fmt.Printf("\0337\r%s\0338", remaining(deadline, time.Now()))
+        }
+    }
+}
+
+// remaining formats the time left from now until deadline as a fixed
+// width prefix.
+func remaining(deadline, now time.Time) string {
+    left := deadline.Sub(now).Round(time.Second)
+    if left < 0 {
+        left = 0
+    }
+    return fmt.Sprintf("[%3ds]", int(left.Seconds()))
+}
+
+func isTerminal(f *os.File) bool {
+    fi, err := f.Stat()
+    return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// parseLimit reads a time limit given either as a number of seconds
+// ("30", "7.5") or as a duration ("1m30s").
+func parseLimit(s string) (time.Duration, error) {
+    if secs, err := strconv.ParseFloat(s, 64); err == nil && secs >= 0 {
+        return time.Duration(secs * float64(time.Second)), nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil || d < 0 {
+        return 0, fmt.Errorf("invalid time limit %q", s)
+    }
+    return d, nil
+}
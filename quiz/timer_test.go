@@ -0,0 +1,141 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+// ticking returns a clock that is advanced by step every time it's read
+func ticking(step time.Duration) func() time.Time {
+    now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+    return func() time.Time {
+        now = now.Add(step)
+        return now
+    }
+}
+
+func TestAskTiming(t *testing.T) {
+    tests := []struct {
+        name     string
+        limit    time.Duration // the problem's own
+        perLimit time.Duration
+        spent    time.Duration // on earlier visits
+        input    string        // nothing is typed if empty
+        asked    bool
+        timedOut bool
+        spentNow time.Duration
+    }{
+        {"no limit", 0, 0, 0, "2", true, false, 3 * time.Second},
+        {"in time", 0, 5 * time.Second, time.Second, "2", true, false, 4 * time.Second},
+        {"time used up", 0, 5 * time.Second, 5 * time.Second, "2", false, true, 5 * time.Second},
+        {"own limit first", 10 * time.Second, 5 * time.Second, 6 * time.Second, "2", true, false, 9 * time.Second},
+        {"own limit used up", 5 * time.Second, 10 * time.Second, 6 * time.Second, "2", false, true, 6 * time.Second},
+        // the read really times out, the clock says how long it took
+        {"runs out", 0, 5 * time.Second, 5*time.Second - 20*time.Millisecond, "", true, true, 5*time.Second + 3*time.Second - 20*time.Millisecond},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            problems := arithmetic("2")
+            problems[0].limit = tt.limit
+            sh := newSheet(problems, tt.perLimit)
+            sh.spent[0] = tt.spent
+            reads := 0
+            clock := ticking(3 * time.Second)
+            sh.now = func() time.Time {
+                reads++
+                return clock()
+            }
+            var r io.Reader = strings.NewReader(tt.input + "\n")
+            if tt.input == "" {
+                pr, pw := io.Pipe()
+                defer pw.Close()
+                r = pr
+            }
+            ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+            defer cancel()
+            if _, err := sh.ask(ctx, 0, newLineReader(r)); err != nil {
+                t.Fatal(err)
+            }
+            if asked := reads > 0; asked != tt.asked {
+                t.Errorf("got asked %v, want %v", asked, tt.asked)
+            }
+            a := sh.answers[0]
+            if a == nil {
+                t.Fatal("no answer")
+            }
+            if a.timedOut != tt.timedOut || sh.locked(0) != tt.timedOut {
+                t.Errorf("got timed out %v and locked %v, want %v", a.timedOut, sh.locked(0), tt.timedOut)
+            }
+            if sh.spent[0] != tt.spentNow || a.latency != tt.spentNow {
+                t.Errorf("got %s spent and a latency of %s, want %s", sh.spent[0], a.latency, tt.spentNow)
+            }
+        })
+    }
+}
+
+func TestRunQuizDeadline(t *testing.T) {
+    r, w := io.Pipe()
+    defer w.Close()
+    go io.WriteString(w, "2\n")
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    ansCh := make(chan Answer, 2)
+    err := runQuiz(ctx, arithmetic("2", "4"), time.Minute, newLineReader(r), ansCh)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("got %v, want the quiz's deadline", err)
+    }
+    close(ansCh)
+    var answers []Answer
+    for a := range ansCh {
+        answers = append(answers, a)
+    }
+    // the question asked when the quiz ran out isn't one that timed out
+    if len(answers) != 1 || answers[0].index != 0 || !answers[0].isCorrect {
+        t.Errorf("got %+v, want only the first question answered", answers)
+    }
+}
+
+func TestRemaining(t *testing.T) {
+    now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        left time.Duration
+        want string
+    }{
+        {12*time.Second + 400*time.Millisecond, "[ 12s]"},
+        {12*time.Second + 600*time.Millisecond, "[ 13s]"},
+        {0, "[  0s]"},
+        {-3 * time.Second, "[  0s]"},
+        {20 * time.Minute, "[1200s]"},
+    }
+    for _, tt := range tests {
+        if got := remaining(now.Add(tt.left), now); got != tt.want {
+            t.Errorf("%s left: got %q, want %q", tt.left, got, tt.want)
+        }
+    }
+}
+
+func TestParseLimit(t *testing.T) {
+    tests := []struct {
+        s    string
+        want time.Duration
+        ok   bool
+    }{
+        {"30", 30 * time.Second, true},
+        {"7.5", 7500 * time.Millisecond, true},
+        {"0", 0, true},
+        {"1m30s", 90 * time.Second, true},
+        {"-5", 0, false},
+        {"-1m", 0, false},
+        {"soon", 0, false},
+    }
+    for _, tt := range tests {
+        got, err := parseLimit(tt.s)
+        if (err == nil) != tt.ok || got != tt.want {
+            t.Errorf("%q: got %s, %v, want %s", tt.s, got, err, tt.want)
+        }
+    }
+}
@@ -0,0 +1,176 @@
+package urlshort
+
+import (
+    "log"
+    "net"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// Click is one redirect of a short path.
+type Click struct {
+    Path      string    `json:"path"`
+    Time      time.Time `json:"time"`
+    Referrer  string    `json:"referrer,omitempty"`
+    UserAgent string    `json:"userAgent,omitempty"`
+    // the client's network rather than its address, see coarseIP
+    IP        string    `json:"ip,omitempty"`
+}
+
+// ClickStore keeps the clicks recorded by Analytics.
+type ClickStore interface {
+    AddClicks(clicks []Click) error
+    // Clicks returns the clicks of path, oldest first.
+    Clicks(path string) ([]Click, error)
+    // ClickCounts returns how many clicks every clicked path has.
+    ClickCounts() (map[string]int, error)
+}
+
+// Analytics records clicks on its own goroutine, so redirects never wait
+// for the click store. Clicks are written in batches.
+type Analytics struct {
+    store   ClickStore
+    clicks  chan Click
+    done    chan struct{}
+    mu      sync.Mutex
+    dropped int
+}
+
+const (
+    clickBuffer   = 1024
+    clickBatch    = 100
+    flushInterval = time.Second
+)
+
+func NewAnalytics(store ClickStore) *Analytics {
+    a := &Analytics{
+        store:  store,
+        clicks: make(chan Click, clickBuffer),
+        done:   make(chan struct{}),
+    }
+    go a.run()
+    return a
+}
+
+// Record queues c to be stored. If the queue is full because the store
+// can't keep up the click is dropped rather than slowing down redirects.
+func (a *Analytics) Record(c Click) {
+    select {
+    case a.clicks <- c:
+    default:
+        a.mu.Lock()
+        a.dropped++
+        a.mu.Unlock()
+    }
+}
+
+// Close stores the queued clicks and stops recording.
+func (a *Analytics) Close() {
+    close(a.clicks)
+    <-a.done
+}
+
+func (a *Analytics) run() {
+    defer close(a.done)
+    t := time.NewTicker(flushInterval)
+    defer t.Stop()
+    batch := make([]Click, 0, clickBatch)
+    flush := func() {
+        a.mu.Lock()
+        if a.dropped > 0 {
+            log.Printf("dropped %d clicks, the click store is too slow\n", a.dropped)
+            a.dropped = 0
+        }
+        a.mu.Unlock()
+        if len(batch) == 0 {
+            return
+        }
+        if err := a.store.AddClicks(batch); err != nil {
+            log.Printf("failed to store %d clicks: %s\n", len(batch), err)
+        }
+        batch = batch[:0]
+    }
+    for {
+        select {
+        case c, ok := <-a.clicks:
+            if !ok {
+                flush()
+                return
+            }
+            batch = append(batch, c)
+            if len(batch) == clickBatch {
+                flush()
+            }
+        case <-t.C:
+            flush()
+        }
+    }
+}
+
+// Track records a click for every request h answers with a redirect,
+// whichever handler in the chain made it.
+func (a *Analytics) Track(h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // read before h runs, handlers may rewrite the request url
+        path := r.URL.Path
+        sw := &statusWriter{ResponseWriter: w}
+        h.ServeHTTP(sw, r)
+        if !isRedirect(sw.status) {
+            return
+        }
+        a.Record(Click{
+            Path:      path,
+            Time:      time.Now().UTC(),
+            Referrer:  r.Referer(),
+            UserAgent: r.UserAgent(),
+            IP:        coarseIP(r.RemoteAddr),
+        })
+    })
+}
+
+func isRedirect(status int) bool {
+    switch status {
+    case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+        return true
+    }
+    return false
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+    http.ResponseWriter
+    status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+    if w.status == 0 {
+        w.status = status
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+    return w.ResponseWriter.Write(b)
+}
+
+// coarseIP drops the host part of the client address so clicks can be
+// told apart by network without storing who made them: ipv4 addresses
+// are cut to their /24, ipv6 addresses to their /48.
+func coarseIP(remoteAddr string) string {
+    host, _, err := net.SplitHostPort(remoteAddr)
+    if err != nil {
+        host = remoteAddr
+    }
+    ip := net.ParseIP(host)
+    if ip == nil {
+        return ""
+    }
+    if v4 := ip.To4(); v4 != nil {
+        return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+    }
+    return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
@@ -0,0 +1,177 @@
+package urlshort
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// APIHandler serves a json api for managing the links in store. Every
+// request needs an "Authorization: Bearer <token>" header.
+//
+//     GET    /api/links          list every link
+//     POST   /api/links          create a link, {"path": ..., "url": ...}
+//     GET    /api/links/<path>   get one link
+//     PUT    /api/links/<path>   change a link, {"url": ..., "query": ..., "status": ...}
+//     DELETE /api/links/<path>   delete a link
+//
+// <path> is the short path without its leading slash.
+func APIHandler(store Store, token string) http.Handler {
+    return RequireToken(token, &api{store: store})
+}
+
+type api struct {
+    store Store
+}
+
+// RequireToken only passes requests with an "Authorization: Bearer
+// <token>" header on to h. An empty token locks h for everyone.
+func RequireToken(token string, h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !authorized(r, token) {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="urlshort"`)
+            jsonError(w, http.StatusUnauthorized, "missing or invalid token")
+            return
+        }
+        h.ServeHTTP(w, r)
+    })
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    rest := strings.TrimPrefix(r.URL.Path, "/api/links")
+    if rest == "" || rest == "/" {
+        switch r.Method {
+        case http.MethodGet:
+            a.list(w)
+        case http.MethodPost:
+            a.create(w, r)
+        default:
+            jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+        }
+        return
+    }
+    path := rest
+    switch r.Method {
+    case http.MethodGet:
+        a.get(w, path)
+    case http.MethodPut:
+        a.update(w, r, path)
+    case http.MethodDelete:
+        a.delete(w, path)
+    default:
+        jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// authorized compares tokens in constant time.
+func authorized(r *http.Request, token string) bool {
+    auth := r.Header.Get("Authorization")
+    if !strings.HasPrefix(auth, "Bearer ") || token == "" {
+        return false
+    }
+    given := strings.TrimPrefix(auth, "Bearer ")
+    return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func (a *api) list(w http.ResponseWriter) {
+    links, err := a.store.List()
+    if err != nil {
+        storeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, links)
+}
+
+func (a *api) get(w http.ResponseWriter, path string) {
+    l, err := a.store.Get(path)
+    if err != nil {
+        storeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, l)
+}
+
+func (a *api) create(w http.ResponseWriter, r *http.Request) {
+    var l Link
+    if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+        jsonError(w, http.StatusBadRequest, "invalid json body")
+        return
+    }
+    if err := l.Validate(); err != nil {
+        jsonError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    // only Shortener makes links it hands out again
+    l.Generated = false
+    l.Created = time.Now().UTC()
+    l.Updated = l.Created
+    if err := a.store.Create(l); err != nil {
+        storeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, l)
+}
+
+func (a *api) update(w http.ResponseWriter, r *http.Request, path string) {
+    var body Link
+    if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+        jsonError(w, http.StatusBadRequest, "invalid json body")
+        return
+    }
+    l, err := a.store.Get(path)
+    if err != nil {
+        storeError(w, err)
+        return
+    }
+    // everything but the path and times can change. A generated link
+    // given settings of its own isn't handed out by Shortener anymore
+    body.Path, body.Created = l.Path, l.Created
+    body.Generated = l.Generated && body.plain()
+    l = body
+    l.Updated = time.Now().UTC()
+    if err := l.Validate(); err != nil {
+        jsonError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err := a.store.Update(l); err != nil {
+        storeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, l)
+}
+
+func (a *api) delete(w http.ResponseWriter, path string) {
+    if err := a.store.Delete(path); err != nil {
+        storeError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// storeError maps store errors to status codes, anything unexpected is
+// logged and hidden from the client.
+func storeError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, ErrNotFound):
+        jsonError(w, http.StatusNotFound, err.Error())
+    case errors.Is(err, ErrExists):
+        jsonError(w, http.StatusConflict, err.Error())
+    default:
+        log.Printf("store error: %s\n", err)
+        jsonError(w, http.StatusInternalServerError, "internal error")
+    }
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func jsonError(w http.ResponseWriter, status int, msg string) {
+    writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,199 @@
+package urlshort
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "time"
+
+    "github.com/boltdb/bolt"
+)
+
+var (
+    linksBucket  = []byte("links")
+    // holds a bucket of clicks per path, keyed by sequence number
+    clicksBucket = []byte("clicks")
+)
+
+// BoltStore keeps links in a BoltDB file, keyed by path.
+type BoltStore struct {
+    db *bolt.DB
+}
+
+// OpenBoltStore opens (or creates) the BoltDB file at path.
+func OpenBoltStore(path string) (*BoltStore, error) {
+    db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        for _, name := range [][]byte{linksBucket, clicksBucket} {
+            if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+    return s.db.Close()
+}
+
+func (s *BoltStore) Get(path string) (Link, error) {
+    var l Link
+    err := s.db.View(func(tx *bolt.Tx) error {
+        v := tx.Bucket(linksBucket).Get([]byte(path))
+        if v == nil {
+            return ErrNotFound
+        }
+        return json.Unmarshal(v, &l)
+    })
+    return l, err
+}
+
+// Lookup scans every link, which is fine for the few thousand links a
+// bolt file is meant for.
+func (s *BoltStore) Lookup(url string) (Link, error) {
+    var found Link
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+            var l Link
+            if err := json.Unmarshal(v, &l); err != nil {
+                return err
+            }
+            if l.Url == url && l.Generated {
+                found = l
+                return errFound
+            }
+            return nil
+        })
+    })
+    switch err {
+    case errFound:
+        return found, nil
+    case nil:
+        return found, ErrNotFound
+    default:
+        return found, err
+    }
+}
+
+// errFound stops a ForEach early
+var errFound = errors.New("found")
+
+// List returns the links sorted by path, the order bolt keeps keys in.
+func (s *BoltStore) List() ([]Link, error) {
+    links := make([]Link, 0)
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+            var l Link
+            if err := json.Unmarshal(v, &l); err != nil {
+                return err
+            }
+            links = append(links, l)
+            return nil
+        })
+    })
+    return links, err
+}
+
+func (s *BoltStore) Create(l Link) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(linksBucket)
+        if b.Get([]byte(l.Path)) != nil {
+            return ErrExists
+        }
+        return putLink(b, l)
+    })
+}
+
+func (s *BoltStore) Update(l Link) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(linksBucket)
+        if b.Get([]byte(l.Path)) == nil {
+            return ErrNotFound
+        }
+        return putLink(b, l)
+    })
+}
+
+func (s *BoltStore) Delete(path string) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(linksBucket)
+        if b.Get([]byte(path)) == nil {
+            return ErrNotFound
+        }
+        return b.Delete([]byte(path))
+    })
+}
+
+func putLink(b *bolt.Bucket, l Link) error {
+    v, err := json.Marshal(l)
+    if err != nil {
+        return err
+    }
+    return b.Put([]byte(l.Path), v)
+}
+
+func (s *BoltStore) AddClicks(clicks []Click) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        all := tx.Bucket(clicksBucket)
+        for _, c := range clicks {
+            b, err := all.CreateBucketIfNotExists([]byte(c.Path))
+            if err != nil {
+                return err
+            }
+            seq, err := b.NextSequence()
+            if err != nil {
+                return err
+            }
+            v, err := json.Marshal(c)
+            if err != nil {
+                return err
+            }
+            key := make([]byte, 8)
+            binary.BigEndian.PutUint64(key, seq)
+            if err := b.Put(key, v); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+func (s *BoltStore) Clicks(path string) ([]Click, error) {
+    clicks := make([]Click, 0)
+    err := s.db.View(func(tx *bolt.Tx) error {
+        b := tx.Bucket(clicksBucket).Bucket([]byte(path))
+        if b == nil {
+            return nil
+        }
+        return b.ForEach(func(k, v []byte) error {
+            var c Click
+            if err := json.Unmarshal(v, &c); err != nil {
+                return err
+            }
+            clicks = append(clicks, c)
+            return nil
+        })
+    })
+    return clicks, err
+}
+
+func (s *BoltStore) ClickCounts() (map[string]int, error) {
+    counts := make(map[string]int)
+    err := s.db.View(func(tx *bolt.Tx) error {
+        all := tx.Bucket(clicksBucket)
+        return all.ForEach(func(k, v []byte) error {
+            counts[string(k)] = all.Bucket(k).Stats().KeyN
+            return nil
+        })
+    })
+    return counts, err
+}
@@ -0,0 +1,338 @@
+package urlshort
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v3"
+)
+
+// Decoder reads the entries of a redirect file in one format.
+type Decoder interface {
+    Decode(data []byte) ([]PathToUrl, error)
+    // Sniff reports whether data looks like the format, for files whose
+    // extension doesn't say. It should be cheap and rather say no.
+    Sniff(data []byte) bool
+}
+
+type format struct {
+    name string
+    exts []string
+    dec  Decoder
+}
+
+var (
+    formatsMu sync.RWMutex
+    // in order of registration, which is the order they're sniffed in
+    formats []format
+)
+
+// RegisterFormat makes a format available to FormatHandler, files and
+// Router sources. Files with one of exts (like ".toml") are decoded with
+// d, files with other extensions are sniffed by every format in the
+// order they were registered. A format registered again replaces the
+// old one.
+func RegisterFormat(name string, d Decoder, exts ...string) {
+    formatsMu.Lock()
+    defer formatsMu.Unlock()
+    f := format{name: name, exts: exts, dec: d}
+    for i := range formats {
+        if formats[i].name == name {
+            formats[i] = f
+            return
+        }
+    }
+    formats = append(formats, f)
+}
+
+// the built in formats. json and toml go before yaml, which would take
+// most json too
+func init() {
+    RegisterFormat("xml", xmlDecoder{}, ".xml")
+    RegisterFormat("json", jsonDecoder{}, ".json")
+    RegisterFormat("toml", tomlDecoder{}, ".toml")
+    RegisterFormat("yaml", yamlDecoder{}, ".yaml", ".yml")
+    RegisterFormat("csv", csvDecoder{}, ".csv")
+    RegisterFormat("lines", linesDecoder{}, ".env", ".links")
+}
+
+// decoderNamed returns the format called name.
+func decoderNamed(name string) (Decoder, error) {
+    formatsMu.RLock()
+    defer formatsMu.RUnlock()
+    for _, f := range formats {
+        if f.name == name {
+            return f.dec, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown format %q. Must be one of %s.", name, formatNames())
+}
+
+// decoderByExt returns the format of filename's extension, ok false if
+// no format has it.
+func decoderByExt(filename string) (Decoder, bool) {
+    ext := strings.ToLower(filepath.Ext(filename))
+    formatsMu.RLock()
+    defer formatsMu.RUnlock()
+    for _, f := range formats {
+        for _, e := range f.exts {
+            if e == ext {
+                return f.dec, true
+            }
+        }
+    }
+    return nil, false
+}
+
+// decoderFor picks the format of a file by its extension and, failing
+// that, by sniffing data.
+func decoderFor(filename string, data []byte) (Decoder, error) {
+    if d, ok := decoderByExt(filename); ok {
+        return d, nil
+    }
+    formatsMu.RLock()
+    defer formatsMu.RUnlock()
+    for _, f := range formats {
+        if f.dec.Sniff(data) {
+            return f.dec, nil
+        }
+    }
+    return nil, fmt.Errorf("can't tell the format of %s. Must be one of %s.", filename, formatNames())
+}
+
+// formatNames lists the formats, formatsMu must be held.
+func formatNames() string {
+    names := make([]string, len(formats))
+    for i, f := range formats {
+        names[i] = f.name
+    }
+    return strings.Join(names, ", ")
+}
+
+type yamlDecoder struct{}
+
+func (yamlDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    var l []PathToUrl
+    if err := yaml.Unmarshal(data, &l); err != nil {
+        return l, err
+    }
+    return l, nil
+}
+
+func (d yamlDecoder) Sniff(data []byte) bool {
+    l, err := d.Decode(data)
+    return err == nil && len(l) > 0
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    var l []PathToUrl
+    if err := json.Unmarshal(data, &l); err != nil {
+        return l, err
+    }
+    return l, nil
+}
+
+func (jsonDecoder) Sniff(data []byte) bool {
+    return bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) && json.Valid(data)
+}
+
+// PathToUrl wrapper for unmarshaling xml
+type PathsToUrlsXML struct {
+    List []PathToUrl `xml:"PathToUrl"`
+}
+
+type xmlDecoder struct{}
+
+func (xmlDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    var l PathsToUrlsXML
+    if err := xml.Unmarshal(data, &l); err != nil {
+        return nil, err
+    }
+    return l.List, nil
+}
+
+func (xmlDecoder) Sniff(data []byte) bool {
+    return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<"))
+}
+
+// tomlDecoder reads an array of tables called links:
+//
+//     [[links]]
+//     path = "/fall"
+//     url = "https://youtu.be/QhBoFEq0lU0"
+type tomlDecoder struct{}
+
+func (tomlDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    var f struct {
+        Links []PathToUrl `toml:"links"`
+    }
+    if _, err := toml.Decode(string(data), &f); err != nil {
+        return nil, err
+    }
+    return f.Links, nil
+}
+
+func (d tomlDecoder) Sniff(data []byte) bool {
+    l, err := d.Decode(data)
+    return err == nil && len(l) > 0
+}
+
+// csvDecoder reads rows of path,url. If the first row is a header (one
+// of its cells is "path") columns are matched by name instead, in any
+// order, and the other PathToUrl fields can be given too:
+//
+//     path,url,status,expires
+//     /sale,https://shop.example.com/sale,307,2024-12-01T00:00:00Z
+type csvDecoder struct{}
+
+func (csvDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    r := csv.NewReader(bytes.NewReader(data))
+    r.FieldsPerRecord = -1
+    r.TrimLeadingSpace = true
+    rows, err := r.ReadAll()
+    if err != nil {
+        return nil, err
+    }
+    columns := []string{"path", "url"}
+    start := 0
+    if len(rows) > 0 {
+        for _, cell := range rows[0] {
+            if strings.EqualFold(strings.TrimSpace(cell), "path") {
+                columns = rows[0]
+                start = 1
+            }
+        }
+    }
+    var l []PathToUrl
+    for i, row := range rows[start:] {
+        if len(row) < 2 {
+            return nil, fmt.Errorf("line %d: want path,url, got %q", start+i+1, strings.Join(row, ","))
+        }
+        var p PathToUrl
+        for j, cell := range row {
+            if j >= len(columns) {
+                break
+            }
+            if err := p.set(columns[j], strings.TrimSpace(cell)); err != nil {
+                return nil, fmt.Errorf("line %d: %w", start+i+1, err)
+            }
+        }
+        l = append(l, p)
+    }
+    return l, nil
+}
+
+func (d csvDecoder) Sniff(data []byte) bool {
+    l, err := d.Decode(data)
+    if err != nil || len(l) == 0 {
+        return false
+    }
+    for _, p := range l {
+        if !strings.HasPrefix(p.Url, "http://") && !strings.HasPrefix(p.Url, "https://") {
+            return false
+        }
+    }
+    return true
+}
+
+// set sets the field called name (as in yaml) from a string.
+func (p *PathToUrl) set(name, value string) error {
+    var err error
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "path":
+        p.Path = value
+    case "url":
+        p.Url = value
+    case "query":
+        p.Query = QueryPolicy(value)
+    case "status":
+        p.Status, err = atoiEmpty(value)
+    case "notbefore":
+        p.NotBefore, err = parseTimeEmpty(value)
+    case "expires":
+        p.Expires, err = parseTimeEmpty(value)
+    case "maxclicks":
+        p.MaxClicks, err = atoiEmpty(value)
+    case "owner":
+        p.Owner = value
+    case "interstitial":
+        p.Interstitial, err = parseBoolEmpty(value)
+    default:
+        return fmt.Errorf("unknown column %q", name)
+    }
+    if err != nil {
+        return fmt.Errorf("invalid %s %q", name, value)
+    }
+    return nil
+}
+
+func atoiEmpty(s string) (int, error) {
+    if s == "" {
+        return 0, nil
+    }
+    return strconv.Atoi(s)
+}
+
+func parseBoolEmpty(s string) (bool, error) {
+    if s == "" {
+        return false, nil
+    }
+    return strconv.ParseBool(s)
+}
+
+func parseTimeEmpty(s string) (time.Time, error) {
+    if s == "" {
+        return time.Time{}, nil
+    }
+    return time.Parse(time.RFC3339, s)
+}
+
+// linesDecoder reads one "path = url" per line, like a .env file. Blank
+// lines and lines starting with # are skipped. The first = splits the
+// line, so paths can't have one.
+type linesDecoder struct{}
+
+func (linesDecoder) Decode(data []byte) ([]PathToUrl, error) {
+    var l []PathToUrl
+    s := bufio.NewScanner(bytes.NewReader(data))
+    for n := 1; s.Scan(); n++ {
+        line := strings.TrimSpace(s.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        path, u, ok := strings.Cut(line, "=")
+        if !ok {
+            return nil, fmt.Errorf("line %d: want path = url, got %q", n, line)
+        }
+        l = append(l, PathToUrl{Path: strings.TrimSpace(path), Url: strings.TrimSpace(u)})
+    }
+    if err := s.Err(); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+func (d linesDecoder) Sniff(data []byte) bool {
+    l, err := d.Decode(data)
+    if err != nil || len(l) == 0 {
+        return false
+    }
+    for _, p := range l {
+        if !strings.HasPrefix(p.Path, "/") && !strings.HasPrefix(p.Path, "~") {
+            return false
+        }
+    }
+    return true
+}
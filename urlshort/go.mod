@@ -2,4 +2,12 @@ module urlshort
 
 go 1.19
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/boltdb/bolt v1.3.1
+	github.com/lib/pq v1.10.7
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.7.0 // indirect
@@ -1,12 +1,10 @@
 package urlshort
 
 import (
+	"errors"
 	"net/http"
-	"net/url"
 	"log"
-	"gopkg.in/yaml.v3"
-	"encoding/json"
-	"encoding/xml"
+	"time"
 )
 
 // MapHandler will return an http.HandlerFunc (which also
@@ -15,25 +13,39 @@ import (
 // that each key in the map points to, in string format).
 // If the path is not provided in the map, then the fallback
 // http.Handler will be called instead.
-func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.HandlerFunc {
+func MapHandler(pathsToUrls map[string]string, fallback http.Handler, opts ...Option) http.HandlerFunc {
+    return StoreHandler(NewMemoryStore(pathsToUrls), fallback, opts...)
+}
+
+// StoreHandler is MapHandler reading through a Store, so links can
+// change while the server runs.
+func StoreHandler(store Store, fallback http.Handler, opts ...Option) http.HandlerFunc {
+    c := newHandlerConfig(opts)
     return func(w http.ResponseWriter, r *http.Request) {
-        urlstr, ok := pathsToUrls[r.URL.Path]
-        if !ok {
+        req, f := readFlags(r)
+        link, err := store.Get(req.URL.Path)
+        if err != nil {
+            if !errors.Is(err, ErrNotFound) {
+                log.Printf("error looking up %s: %s\n", r.URL.Path, err)
+            }
             // short url not found
             fallback.ServeHTTP(w,r)
             return
         }
-        dest, err := url.Parse(urlstr)
-        if err != nil {
-            // error parsing long url
-            log.Printf("error parsing long url %s. possibly invalid format.\n", urlstr)
+        c.serve(w, req, link.target(), f, fallback)
+    }
+}
+
+// rulesHandler redirects paths matching a rule in rs, see ruleKind.
+func rulesHandler(rs *ruleSet, fallback http.Handler, c *handlerConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        req, f := readFlags(r)
+        t, ok := rs.resolve(req.URL)
+        if !ok {
             fallback.ServeHTTP(w,r)
             return
         }
-        // update url host and path, preserve all else (query params etc)
-        r.URL.Host = dest.Host
-        r.URL.Path = dest.Path
-        http.Redirect(w, r, r.URL.String(), 302)
+        c.serve(w, req, t, f, fallback)
     }
 }
 
@@ -48,90 +60,84 @@ func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.Handl
 //     - path: /some-path
 //       url: https://www.some-url.com/demo
 //
-// The only errors that can be returned all related to having
-// invalid YAML data.
+// Paths may also be patterns like /gh/{user}/{repo}, see ruleKind.
+// Entries can set what happens to query strings (see QueryPolicy), the
+// redirect status and when the link works:
+//
+//     - path: /register
+//       url: https://events.example.com/signup
+//       status: 307
+//       notBefore: 2024-05-01T09:00:00Z
+//       expires: 2024-05-08T00:00:00Z
+//       maxClicks: 500
+//
+// Expired links and links out of clicks answer 410 Gone. An owner is
+// shown on the link's preview page (/register+) and interstitial: true
+// warns before leaving for another site.
+//
+// Invalid YAML is returned as the decoder's error. Entries that don't
+// make sense, like duplicate paths, bad urls, bad patterns or redirects
+// looping through the shortener's own hosts (see WithHosts), are
+// returned together as a ValidationError.
 //
 // See MapHandler to create a similar http.HandlerFunc via
 // a mapping of paths to urls.
 
-// supported serialization formats
-type fileType int
-const (
-    jsonf   fileType = iota
-    yamlf
-    xmlf
-)
-
 // PathToUrl: data structure representing a short path to long url kv-pair
-// yaml, json, and xml formats must have underlying []PathToUrl structure
+// every format decodes to a []PathToUrl, see Decoder
 type PathToUrl struct {
-    Path string
-    Url  string
+    Path  string
+    Url   string
+    // what happens to the request's query string, append by default
+    Query QueryPolicy
+    // optional: redirect status (302 by default), when the link starts
+    // and stops working and how many times it can be used
+    Status    int
+    NotBefore time.Time `yaml:"notBefore"`
+    Expires   time.Time
+    MaxClicks int       `yaml:"maxClicks"`
+    // optional: who to ask about the link, shown on its preview page,
+    // and whether to warn before leaving for another site
+    Owner        string
+    Interstitial bool
 }
 
-// PathToUrl wrapper for unmarshaling xml
-type PathsToUrlsXML struct {
-    List []PathToUrl `xml:"PathToUrl"`
+func YAMLHandler(yml []byte, fallback http.Handler, opts ...Option) (http.HandlerFunc, error) {
+    return convertToMapHandler(yml, fallback, yamlDecoder{}, newHandlerConfig(opts))
 }
 
-func parseYAML(yml []byte) ([]PathToUrl, error) {
-    var l []PathToUrl
-    if err := yaml.Unmarshal(yml, &l); err != nil {
-        return l, err
-    }
-    return l, nil
+func JSONHandler(jsn []byte, fallback http.Handler, opts ...Option) (http.HandlerFunc, error) {
+    return convertToMapHandler(jsn, fallback, jsonDecoder{}, newHandlerConfig(opts))
 }
 
-func parseJSON(jsn []byte) ([]PathToUrl, error) {
-    var l []PathToUrl
-    if err := json.Unmarshal(jsn, &l); err != nil {
-        return l, err
-    }
-    return l, nil
+func XMLHandler(xm []byte, fallback http.Handler, opts ...Option) (http.HandlerFunc, error) {
+    return convertToMapHandler(xm, fallback, xmlDecoder{}, newHandlerConfig(opts))
 }
 
-func parseXML(xm []byte) ([]PathToUrl, error) {
-    var l PathsToUrlsXML
-    if err := xml.Unmarshal(xm, &l); err != nil {
+// FormatHandler is YAMLHandler for any registered format, see
+// RegisterFormat. The built in ones are xml, json, toml, yaml, csv and
+// lines ("path = url" lines).
+func FormatHandler(format string, data []byte, fallback http.Handler, opts ...Option) (http.HandlerFunc, error) {
+    d, err := decoderNamed(format)
+    if err != nil {
         return nil, err
     }
-    return l.List, nil
+    return convertToMapHandler(data, fallback, d, newHandlerConfig(opts))
 }
 
-func buildMap(l []PathToUrl) map[string]string {
-    m := make(map[string]string)
-    for _, entry := range l {
-        m[entry.Path] = entry.Url
+func convertToMapHandler(dat []byte, fallback http.Handler, d Decoder, c *handlerConfig) (http.HandlerFunc, error) {
+    rs, err := parseRules(dat, d, c)
+    if err != nil {
+        return nil, err
     }
-    return m
+    return rulesHandler(rs, fallback, c), nil
 }
 
-func YAMLHandler(yml []byte, fallback http.Handler) (http.HandlerFunc, error) {
-    return convertToMapHandler(yml, fallback, yamlf)
-}
-
-func JSONHandler(jsn []byte, fallback http.Handler) (http.HandlerFunc, error) {
-    return convertToMapHandler(jsn, fallback, jsonf)
-}
-
-func XMLHandler(xm []byte, fallback http.Handler) (http.HandlerFunc, error) {
-    return convertToMapHandler(xm, fallback, xmlf)
-}
-
-func convertToMapHandler(dat []byte, fallback http.Handler, f fileType) (http.HandlerFunc, error) {
-    var parsed []PathToUrl
-    var err error
-    switch f {
-    case yamlf:
-        parsed, err = parseYAML(dat)
-    case jsonf:
-        parsed, err = parseJSON(dat)
-    case xmlf:
-        parsed, err = parseXML(dat)
-    }
+// parseRules parses and checks a redirect file.
+func parseRules(dat []byte, d Decoder, c *handlerConfig) (*ruleSet, error) {
+    parsed, err := d.Decode(dat)
     if err != nil {
         return nil, err
     }
-    pathMap := buildMap(parsed)
-    return MapHandler(pathMap, fallback), nil
+    return newRuleSet(parsed, c.hosts)
 }
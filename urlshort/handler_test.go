@@ -0,0 +1,963 @@
+package urlshort
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    _ "github.com/lib/pq"
+)
+
+func TestDestination(t *testing.T) {
+    tests := []struct {
+        name   string
+        req    string
+        dest   string
+        policy QueryPolicy
+        want   string
+    }{
+        {"no queries", "/a", "https://example.com/x", "", "https://example.com/x"},
+        {"scheme kept", "/a", "https://example.com/x", QueryAppend, "https://example.com/x"},
+        {"http kept", "/a", "http://example.com/x", QueryAppend, "http://example.com/x"},
+        {"fragment kept", "/a?b=1", "https://example.com/x#top", QueryAppend, "https://example.com/x?b=1#top"},
+        {"append to none", "/a?b=1", "https://example.com/x", QueryAppend, "https://example.com/x?b=1"},
+        {"append default", "/a?b=1", "https://example.com/x?a=1", "", "https://example.com/x?a=1&b=1"},
+        {"append keeps both", "/a?a=2", "https://example.com/x?a=1", QueryAppend, "https://example.com/x?a=1&a=2"},
+        {"append without request query", "/a", "https://example.com/x?a=1", QueryAppend, "https://example.com/x?a=1"},
+        {"override same key", "/a?a=2", "https://example.com/x?a=1&c=3", QueryOverride, "https://example.com/x?a=2&c=3"},
+        {"override new key", "/a?b=2", "https://example.com/x?a=1", QueryOverride, "https://example.com/x?a=1&b=2"},
+        {"keep", "/a?b=2", "https://example.com/x?a=1#f", QueryKeep, "https://example.com/x?a=1#f"},
+        {"keep without dest query", "/a?b=2", "https://example.com/x", QueryKeep, "https://example.com/x"},
+        {"drop", "/a?b=2", "https://example.com/x?a=1#f", QueryDrop, "https://example.com/x#f"},
+        {"escaped path", "/a?q=a%20b", "https://example.com/a%2Fb", QueryAppend, "https://example.com/a%2Fb?q=a%20b"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req, err := url.Parse(tt.req)
+            if err != nil {
+                t.Fatal(err)
+            }
+            got, err := Destination(req, tt.dest, tt.policy)
+            if err != nil {
+                t.Fatalf("unexpected error: %s", err)
+            }
+            if got.String() != tt.want {
+                t.Errorf("got %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestQueryPolicyValidate(t *testing.T) {
+    for _, p := range []QueryPolicy{"", QueryAppend, QueryOverride, QueryKeep, QueryDrop} {
+        if err := p.Validate(); err != nil {
+            t.Errorf("%q: unexpected error %s", p, err)
+        }
+    }
+    if err := QueryPolicy("merge").Validate(); err == nil {
+        t.Errorf("merge: expected an error")
+    }
+}
+
+func TestYAMLHandlerRedirects(t *testing.T) {
+    yml := `
+- path: /plain
+  url: https://example.com/plain?ref=short
+- path: /keep
+  url: https://example.com/keep?ref=short
+  query: keep
+- path: /gh/{user}
+  url: https://github.com/{user}?tab=repositories
+  query: override
+`
+    fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusTeapot)
+    })
+    h, err := YAMLHandler([]byte(yml), fallback)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        req      string
+        status   int
+        location string
+    }{
+        {"/plain?utm=x", http.StatusFound, "https://example.com/plain?ref=short&utm=x"},
+        {"/keep?utm=x", http.StatusFound, "https://example.com/keep?ref=short"},
+        {"/gh/pahyde?tab=stars", http.StatusFound, "https://github.com/pahyde?tab=stars"},
+        {"/missing", http.StatusTeapot, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.req, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+            if w.Code != tt.status {
+                t.Errorf("got status %d, want %d", w.Code, tt.status)
+            }
+            if got := w.Header().Get("Location"); got != tt.location {
+                t.Errorf("got location %q, want %q", got, tt.location)
+            }
+        })
+    }
+}
+
+func TestInvalidQueryPolicy(t *testing.T) {
+    yml := `
+- path: /a
+  url: https://example.com
+  query: merge
+`
+    if _, err := YAMLHandler([]byte(yml), http.NotFoundHandler()); err == nil {
+        t.Errorf("expected an error for an unknown query policy")
+    }
+}
+
+func TestLinkLimits(t *testing.T) {
+    yml := `
+- path: /moved
+  url: https://example.com/moved
+  status: 301
+- path: /early
+  url: https://example.com/early
+  notBefore: 2024-05-01T09:00:00Z
+- path: /late
+  url: https://example.com/late
+  expires: 2024-04-01T00:00:00Z
+- path: /twice
+  url: https://example.com/twice
+  maxClicks: 2
+`
+    now := func() time.Time { return time.Date(2024, 4, 15, 12, 0, 0, 0, time.UTC) }
+    h, err := YAMLHandler([]byte(yml), http.NotFoundHandler(), WithClock(now))
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        req    string
+        status int
+    }{
+        {"/moved", http.StatusMovedPermanently},
+        {"/early", http.StatusNotFound},
+        {"/late", http.StatusGone},
+        {"/twice", http.StatusFound},
+        {"/twice", http.StatusFound},
+        {"/twice", http.StatusGone},
+    }
+    for _, tt := range tests {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+        if w.Code != tt.status {
+            t.Errorf("%s: got status %d, want %d", tt.req, w.Code, tt.status)
+        }
+    }
+}
+
+func TestPatternClickLimits(t *testing.T) {
+    yml := `
+- path: /gh/{user}/{repo}
+  url: https://github.com/{user}/{repo}
+  maxClicks: 3
+- path: /gh/me/home
+  url: https://example.com/home
+`
+    // what a restart finds: clicks are stored by the path asked for
+    store := NewMemoryStore(nil)
+    store.AddClicks([]Click{
+        {Path: "/gh/a/b"},
+        {Path: "/gh/c/d"},
+        {Path: "/gh/me/home"},
+        {Path: "/gh/me/home"},
+    })
+    limiter := NewClickLimiter(store)
+    h, err := YAMLHandler([]byte(yml), http.NotFoundHandler(), WithClickLimiter(limiter))
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        req    string
+        status int
+    }{
+        {"/gh/e/f", http.StatusFound},
+        {"/gh/g/h", http.StatusGone},
+        {"/gh/me/home", http.StatusFound},
+    }
+    for _, tt := range tests {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+        if w.Code != tt.status {
+            t.Errorf("%s: got status %d, want %d", tt.req, w.Code, tt.status)
+        }
+    }
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gh/a/b+", nil))
+    if !strings.Contains(w.Body.String(), "used up") {
+        t.Errorf("preview of a used up pattern doesn't say so:\n%s", w.Body.String())
+    }
+}
+
+func TestInvalidLinkLimits(t *testing.T) {
+    for _, yml := range []string{
+        "- {path: /a, url: https://example.com, status: 200}",
+        "- {path: /a, url: https://example.com, maxClicks: -1}",
+        "- {path: /a, url: https://example.com, notBefore: 2024-05-01T00:00:00Z, expires: 2024-04-01T00:00:00Z}",
+    } {
+        if _, err := YAMLHandler([]byte(yml), http.NotFoundHandler()); err == nil {
+            t.Errorf("%s: expected an error", yml)
+        }
+    }
+}
+
+func TestValidation(t *testing.T) {
+    yml := `
+- path: /ok
+  url: https://example.com
+- path: no-slash
+  url: https://example.com
+- path: /ok
+  url: https://example.com/again
+- path: /ftp
+  url: ftp://example.com/file
+- path: /bad
+  url: "https://exa mple.com"
+- path: /a
+  url: http://sho.rt/b
+- path: /b
+  url: http://SHO.RT/a?x=1
+- path: /self
+  url: http://sho.rt/self
+- path: /out
+  url: http://sho.rt/a
+`
+    _, err := YAMLHandler([]byte(yml), http.NotFoundHandler(), WithHosts("sho.rt"))
+    var verr ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("got %v, want a ValidationError", err)
+    }
+    var got []int
+    for _, e := range verr {
+        got = append(got, e.Index)
+    }
+    want := []int{1, 2, 3, 4, 5, 6, 7}
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("got errors for entries %v, want %v\n%s", got, want, err)
+    }
+}
+
+func TestRulePrecedence(t *testing.T) {
+    yml := `
+- path: /gh/*
+  url: https://github.com/{*}
+- path: ~/gh/(\d+)
+  url: https://issues.example.com/{1}
+- path: /gh/{user}/{repo}
+  url: https://github.com/{user}/{repo}
+- path: /gh/pahyde/*
+  url: https://pahyde.dev/all/{*}
+- path: /gh/pahyde/{repo}
+  url: https://pahyde.dev/{repo}
+- path: /gh/pahyde/gophercises
+  url: https://pahyde.dev/gophercises/home
+- path: ~/issue/(\d+)/(?P<part>[a-z]+)
+  url: https://issues.example.com/{1}?part={part}
+- path: /t/{a}/x
+  url: https://example.com/first/{a}
+- path: /t/x/{b}
+  url: https://example.com/second/{b}
+- path: ~/r/\w+
+  url: https://example.com/word
+- path: ~/r/\d+
+  url: https://example.com/digits
+- path: /hello world
+  url: https://example.com/hello
+`
+    h, err := YAMLHandler([]byte(yml), http.NotFoundHandler())
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        req      string
+        location string
+    }{
+        // exact beats everything
+        {"/gh/pahyde/gophercises", "https://pahyde.dev/gophercises/home"},
+        // then params, the most literal segments first
+        {"/gh/pahyde/quiz", "https://pahyde.dev/quiz"},
+        {"/gh/golang/go", "https://github.com/golang/go"},
+        // then the longest prefix
+        {"/gh/pahyde/quiz/issues", "https://pahyde.dev/all/quiz/issues"},
+        {"/gh/golang/go/issues", "https://github.com/golang/go/issues"},
+        {"/gh/", "https://github.com/"},
+        // a prefix beats a regex
+        {"/gh/123", "https://github.com/123"},
+        // regex captures, numbered and named
+        {"/issue/42/body", "https://issues.example.com/42?part=body"},
+        // ties go to the first in the file
+        {"/t/x/x", "https://example.com/first/x"},
+        {"/t/y/x", "https://example.com/first/y"},
+        {"/t/x/y", "https://example.com/second/y"},
+        {"/r/123", "https://example.com/word"},
+        // exact paths are unescaped, patterns match and capture the
+        // escaped path
+        {"/hello%20world", "https://example.com/hello"},
+        {"/gh/a%2Fb/c", "https://github.com/a%2Fb/c"},
+        {"/gh/pahyde/a%20b", "https://pahyde.dev/a%20b"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.req, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+            if got := w.Header().Get("Location"); got != tt.location {
+                t.Errorf("got location %q, want %q", got, tt.location)
+            }
+        })
+    }
+    for _, req := range []string{"/issue/42", "/issue/x/body", "/t/x", "/r/", "/gh"} {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, req, nil))
+        if w.Code != http.StatusNotFound {
+            t.Errorf("%s: got status %d, want %d", req, w.Code, http.StatusNotFound)
+        }
+    }
+}
+
+func TestInvalidRules(t *testing.T) {
+    for _, yml := range []string{
+        "- {path: '~/(', url: https://example.com}",
+        "- {path: '/a/{1x}', url: https://example.com}",
+        "- {path: '/a/{x}/{x}', url: https://example.com}",
+        "- {path: '/a/b{x}', url: https://example.com}",
+        "- {path: '/a/{x}', url: 'https://example.com/{y}'}",
+        "- {path: '/a/*', url: 'https://example.com/{x}'}",
+        "- {path: '~/(\\d+)', url: 'https://example.com/{2}'}",
+    } {
+        var verr ValidationError
+        if _, err := YAMLHandler([]byte(yml), http.NotFoundHandler()); !errors.As(err, &verr) {
+            t.Errorf("%s: got %v, want a ValidationError", yml, err)
+        }
+    }
+}
+
+func TestRouterPrecedence(t *testing.T) {
+    rt := NewRouter(http.NotFoundHandler())
+    rt.AddMap("map", map[string]string{"/a": "https://map.example.com/a"})
+    if err := rt.AddData("first.yaml", []byte("- {path: /a, url: https://first.example.com/a}")); err != nil {
+        t.Fatal(err)
+    }
+    if err := rt.AddData("second.json", []byte(`[{"path": "/b/{x}", "url": "https://second.example.com/{x}"}]`)); err != nil {
+        t.Fatal(err)
+    }
+    routes, err := rt.Resolve("/a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(routes) != 2 || routes[0].Source != "map" || routes[1].Source != "first.yaml" {
+        t.Errorf("got %v, want map then first.yaml", routes)
+    }
+    w := httptest.NewRecorder()
+    rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/b/c", nil))
+    if got := w.Header().Get("Location"); got != "https://second.example.com/c" {
+        t.Errorf("got location %q", got)
+    }
+    listings, err := rt.List()
+    if err != nil {
+        t.Fatal(err)
+    }
+    shadowed := 0
+    for _, l := range listings {
+        if l.ShadowedBy != "" {
+            shadowed++
+        }
+    }
+    if len(listings) != 3 || shadowed != 1 {
+        t.Errorf("got %v, want 3 routes with 1 shadowed", listings)
+    }
+}
+
+func TestFileHandlerReload(t *testing.T) {
+    filename := filepath.Join(t.TempDir(), "links.yaml")
+    version := time.Now()
+    write := func(content string) {
+        t.Helper()
+        if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+            t.Fatal(err)
+        }
+        // some file systems only keep whole seconds
+        version = version.Add(time.Second)
+        if err := os.Chtimes(filename, version, version); err != nil {
+            t.Fatal(err)
+        }
+    }
+    location := func(h http.Handler, req string) string {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, req, nil))
+        return w.Header().Get("Location")
+    }
+
+    write("- {path: /a, url: https://example.com/old}")
+    h, err := NewFileHandler(filename, http.NotFoundHandler())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if changed, err := h.Reload(); changed || err != nil {
+        t.Errorf("reload of an unchanged file: got %v, %v", changed, err)
+    }
+
+    write("- {path: /a, url: https://example.com/new}\n- {path: /b, url: https://example.com/b}")
+    if changed, err := h.Reload(); !changed || err != nil {
+        t.Fatalf("reload of a good file: got %v, %v", changed, err)
+    }
+    if got := location(h, "/a"); got != "https://example.com/new" {
+        t.Errorf("after reload /a goes to %q", got)
+    }
+
+    for _, broken := range []string{
+        "- {path: /a, url: [",
+        "- {path: /a, url: https://example.com/x}\n- {path: /a, url: https://example.com/y}",
+    } {
+        write(broken)
+        var verr ValidationError
+        changed, err := h.Reload()
+        if changed || err == nil {
+            t.Errorf("reload of %q: got %v, %v", broken, changed, err)
+        }
+        if strings.Contains(broken, "/y") && !errors.As(err, &verr) {
+            t.Errorf("reload of a duplicate path: got %v, want a ValidationError", err)
+        }
+        // a broken file is only reported once
+        if changed, err := h.Reload(); changed || err != nil {
+            t.Errorf("second reload of %q: got %v, %v", broken, changed, err)
+        }
+        if got := location(h, "/a"); got != "https://example.com/new" {
+            t.Errorf("the old rules weren't kept, /a goes to %q", got)
+        }
+        if got := location(h, "/b"); got != "https://example.com/b" {
+            t.Errorf("the old rules weren't kept, /b goes to %q", got)
+        }
+    }
+}
+
+func TestFormats(t *testing.T) {
+    tests := []struct {
+        name string
+        data string
+    }{
+        {"links.toml", "[[links]]\npath = \"/a\"\nurl = \"https://example.com/a\"\nstatus = 301\n"},
+        {"links.csv", "/a,https://example.com/a\n/b,https://example.com/b\n"},
+        {"links.env", "# team links\n/a = https://example.com/a?x=1\n\n/b=https://example.com/b\n"},
+        {"header.csv", "url,path,status\nhttps://example.com/a,/a,307\n"},
+        // no extension, sniffed
+        {"toml", "[[links]]\npath = \"/a\"\nurl = \"https://example.com/a\"\n"},
+        {"csv", "/a, https://example.com/a\n"},
+        {"lines", "/a = https://example.com/a\n"},
+        {"yaml", "- path: /a\n  url: https://example.com/a\n"},
+        {"json", `[{"path": "/a", "url": "https://example.com/a"}]`},
+        {"xml", "<PathsToUrls><PathToUrl><Path>/a</Path><Url>https://example.com/a</Url></PathToUrl></PathsToUrls>"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            d, err := decoderFor(tt.name, []byte(tt.data))
+            if err != nil {
+                t.Fatal(err)
+            }
+            l, err := d.Decode([]byte(tt.data))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(l) == 0 || l[0].Path != "/a" || !strings.HasPrefix(l[0].Url, "https://example.com/a") {
+                t.Errorf("got %+v, want /a first", l)
+            }
+        })
+    }
+    if _, err := decoderFor("notes", []byte("just some text\n")); err == nil {
+        t.Errorf("expected plain text not to be sniffed as a format")
+    }
+}
+
+func TestPreviewAndInterstitial(t *testing.T) {
+    yml := `
+- path: /docs
+  url: https://docs.example.com/start?v=2
+  owner: docs-team
+- path: /ext
+  url: https://elsewhere.example.com/
+  interstitial: true
+- path: /home
+  url: http://sho.rt/docs
+  interstitial: true
+`
+    h, err := YAMLHandler([]byte(yml), http.NotFoundHandler(), WithHosts("sho.rt"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        req      string
+        status   int
+        location string
+        body     string
+    }{
+        {"/docs+", http.StatusOK, "", "docs-team"},
+        {"/docs?preview", http.StatusOK, "", "https://docs.example.com/start?v=2"},
+        {"/docs?a=1&preview", http.StatusOK, "", "/docs?a=1&amp;go"},
+        {"/docs?preview=no", http.StatusFound, "https://docs.example.com/start?v=2&preview=no", ""},
+        {"/ext", http.StatusOK, "", "You're leaving"},
+        {"/ext?go", http.StatusFound, "https://elsewhere.example.com/", ""},
+        {"/home", http.StatusFound, "http://sho.rt/docs", ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.req, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+            if w.Code != tt.status {
+                t.Errorf("got status %d, want %d", w.Code, tt.status)
+            }
+            if got := w.Header().Get("Location"); got != tt.location {
+                t.Errorf("got location %q, want %q", got, tt.location)
+            }
+            if !strings.Contains(w.Body.String(), tt.body) {
+                t.Errorf("body doesn't have %q:\n%s", tt.body, w.Body)
+            }
+        })
+    }
+}
+
+func TestQRHandler(t *testing.T) {
+    rt := NewRouter(http.NotFoundHandler())
+    rt.AddMap("map", map[string]string{"/fall": "https://youtu.be/QhBoFEq0lU0"})
+    h := QRHandler(rt)
+    tests := []struct {
+        req         string
+        status      int
+        contentType string
+    }{
+        {"/qr/fall", http.StatusOK, "image/png"},
+        {"/qr/fall?format=svg&size=128&level=h", http.StatusOK, "image/svg+xml"},
+        {"/qr/missing", http.StatusNotFound, ""},
+        {"/qr/fall?size=10", http.StatusBadRequest, ""},
+        {"/qr/fall?level=X", http.StatusBadRequest, ""},
+        {"/qr/fall?format=gif", http.StatusBadRequest, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.req, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.req, nil))
+            if w.Code != tt.status {
+                t.Errorf("got status %d, want %d", w.Code, tt.status)
+            }
+            if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+                t.Errorf("got content type %q, want %q", w.Header().Get("Content-Type"), tt.contentType)
+            }
+        })
+    }
+}
+
+// testStore runs a store through the Store contract. Paths start with
+// prefix, so a shared database can be used.
+func testStore(t *testing.T, s Store, prefix string) {
+    t.Helper()
+    created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+    a := Link{Path: prefix + "/a", Url: "https://example.com/a", Created: created, Updated: created}
+    b := Link{Path: prefix + "/b", Url: "https://example.com/b", Status: 301, MaxClicks: 5, Owner: "ann", Created: created, Updated: created}
+    b.Generated = true
+    // times keep their instant whatever their zone
+    b.Expires = time.Date(2024, 5, 1, 9, 0, 0, 0, time.FixedZone("", 2*60*60))
+    for _, l := range []Link{b, a} {
+        if err := s.Create(l); err != nil {
+            t.Fatalf("create %s: %s", l.Path, err)
+        }
+    }
+    if err := s.Create(Link{Path: a.Path, Url: "https://example.com/other", Created: created, Updated: created}); !errors.Is(err, ErrExists) {
+        t.Errorf("create of a taken path: got %v, want ErrExists", err)
+    }
+    got, err := s.Get(a.Path)
+    if err != nil || got.Url != a.Url || !got.Created.Equal(created) {
+        t.Errorf("get %s: got %+v, %v", a.Path, got, err)
+    }
+    got, err = s.Get(b.Path)
+    if err != nil || got.Status != 301 || got.MaxClicks != 5 || got.Owner != "ann" || !got.Expires.Equal(b.Expires) {
+        t.Errorf("get %s: got %+v, %v", b.Path, got, err)
+    }
+    if _, err := s.Get(prefix + "/missing"); !errors.Is(err, ErrNotFound) {
+        t.Errorf("get of a missing path: got %v, want ErrNotFound", err)
+    }
+    if got, err := s.Lookup(b.Url); err != nil || got.Path != b.Path {
+        t.Errorf("lookup %s: got %+v, %v", b.Url, got, err)
+    }
+    if _, err := s.Lookup("https://example.com/nowhere" + prefix); !errors.Is(err, ErrNotFound) {
+        t.Errorf("lookup of a missing url: got %v, want ErrNotFound", err)
+    }
+    if _, err := s.Lookup(a.Url); !errors.Is(err, ErrNotFound) {
+        t.Errorf("lookup of a link that wasn't generated: got %v, want ErrNotFound", err)
+    }
+
+    a.Url = "https://example.com/a2"
+    if err := s.Update(a); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := s.Get(a.Path); got.Url != a.Url {
+        t.Errorf("after update got url %q, want %q", got.Url, a.Url)
+    }
+    if err := s.Update(Link{Path: prefix + "/missing", Url: "https://example.com"}); !errors.Is(err, ErrNotFound) {
+        t.Errorf("update of a missing path: got %v, want ErrNotFound", err)
+    }
+
+    links, err := s.List()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var paths []string
+    for _, l := range links {
+        if strings.HasPrefix(l.Path, prefix+"/") {
+            paths = append(paths, l.Path)
+        }
+    }
+    if fmt.Sprint(paths) != fmt.Sprint([]string{a.Path, b.Path}) {
+        t.Errorf("list: got %v", paths)
+    }
+
+    // of concurrent creates of a path only one wins
+    var wg sync.WaitGroup
+    errs := make([]error, 10)
+    for i := range errs {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            errs[i] = s.Create(Link{Path: prefix + "/race", Url: fmt.Sprintf("https://example.com/%d", i), Created: created, Updated: created})
+        }(i)
+    }
+    wg.Wait()
+    won := 0
+    for _, err := range errs {
+        switch {
+        case err == nil:
+            won++
+        case !errors.Is(err, ErrExists):
+            t.Errorf("concurrent create: %s", err)
+        }
+    }
+    if won != 1 {
+        t.Errorf("%d concurrent creates of one path succeeded, want 1", won)
+    }
+
+    for _, path := range []string{a.Path, b.Path, prefix + "/race"} {
+        if err := s.Delete(path); err != nil {
+            t.Errorf("delete %s: %s", path, err)
+        }
+    }
+    if err := s.Delete(a.Path); !errors.Is(err, ErrNotFound) {
+        t.Errorf("delete of a missing path: got %v, want ErrNotFound", err)
+    }
+    if _, err := s.Get(a.Path); !errors.Is(err, ErrNotFound) {
+        t.Errorf("get after delete: got %v, want ErrNotFound", err)
+    }
+}
+
+func TestMemoryStore(t *testing.T) {
+    testStore(t, NewMemoryStore(nil), "")
+}
+
+func TestBoltStore(t *testing.T) {
+    s, err := OpenBoltStore(filepath.Join(t.TempDir(), "links.db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer s.Close()
+    testStore(t, s, "")
+}
+
+// TestSQLStore needs a postgres database it may create tables in, set
+// URLSHORT_TEST_POSTGRES to its url to run it.
+func TestSQLStore(t *testing.T) {
+    dsn := os.Getenv("URLSHORT_TEST_POSTGRES")
+    if dsn == "" {
+        t.Skip("URLSHORT_TEST_POSTGRES isn't set")
+    }
+    db, err := sql.Open("postgres", dsn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewSQLStore(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer s.Close()
+    testStore(t, s, fmt.Sprintf("/test%d", time.Now().UnixNano()))
+}
+
+func TestReserved(t *testing.T) {
+    for path, want := range map[string]bool{
+        "/api":          true,
+        "/api/links":    true,
+        "/shorten":      true,
+        "/stats/x":      true,
+        "/qr":           true,
+        "/qr/abc":       true,
+        "/apis":         false,
+        "/shortened":    false,
+        "/qrcode":       false,
+        "/docs/api":     false,
+        "/":             false,
+    } {
+        if got := Reserved(path); got != want {
+            t.Errorf("Reserved(%q) = %v, want %v", path, got, want)
+        }
+    }
+}
+
+func TestAPIHandler(t *testing.T) {
+    store := NewMemoryStore(nil)
+    h := APIHandler(store, "secret")
+    do := func(method, path, token string, body any) (int, map[string]any) {
+        t.Helper()
+        var r *http.Request
+        if body != nil {
+            b, _ := json.Marshal(body)
+            r = httptest.NewRequest(method, path, bytes.NewReader(b))
+        } else {
+            r = httptest.NewRequest(method, path, nil)
+        }
+        if token != "" {
+            r.Header.Set("Authorization", "Bearer "+token)
+        }
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, r)
+        var v map[string]any
+        json.Unmarshal(w.Body.Bytes(), &v)
+        return w.Code, v
+    }
+
+    tests := []struct {
+        method, path, token string
+        body                any
+        status              int
+    }{
+        {"GET", "/api/links", "", nil, http.StatusUnauthorized},
+        {"GET", "/api/links", "wrong", nil, http.StatusUnauthorized},
+        {"POST", "/api/links", "secret", map[string]any{"path": "/fall", "url": "https://example.com/fall"}, http.StatusCreated},
+        {"POST", "/api/links", "secret", map[string]any{"path": "/fall", "url": "https://example.com/other"}, http.StatusConflict},
+        {"POST", "/api/links", "secret", map[string]any{"path": "/api/links", "url": "https://example.com"}, http.StatusBadRequest},
+        {"POST", "/api/links", "secret", map[string]any{"path": "/qr/x", "url": "https://example.com"}, http.StatusBadRequest},
+        {"POST", "/api/links", "secret", map[string]any{"path": "/bad", "url": "ftp://example.com"}, http.StatusBadRequest},
+        {"POST", "/api/links", "secret", "not a link", http.StatusBadRequest},
+        {"GET", "/api/links/fall", "secret", nil, http.StatusOK},
+        {"GET", "/api/links/missing", "secret", nil, http.StatusNotFound},
+        {"PUT", "/api/links/fall", "secret", map[string]any{"url": "https://example.com/autumn", "status": 301}, http.StatusOK},
+        {"PUT", "/api/links/fall", "secret", map[string]any{"url": "https://example.com", "status": 200}, http.StatusBadRequest},
+        {"PUT", "/api/links/missing", "secret", map[string]any{"url": "https://example.com"}, http.StatusNotFound},
+        {"PATCH", "/api/links/fall", "secret", nil, http.StatusMethodNotAllowed},
+    }
+    for _, tt := range tests {
+        if status, v := do(tt.method, tt.path, tt.token, tt.body); status != tt.status {
+            t.Errorf("%s %s %v: got status %d, want %d: %v", tt.method, tt.path, tt.body, status, tt.status, v)
+        }
+    }
+    l, err := store.Get("/fall")
+    if err != nil || l.Url != "https://example.com/autumn" || l.Status != 301 || l.Created.IsZero() {
+        t.Errorf("after update the store has %+v, %v", l, err)
+    }
+    if status, _ := do("DELETE", "/api/links/fall", "secret", nil); status != http.StatusNoContent {
+        t.Errorf("delete: got status %d", status)
+    }
+    if status, _ := do("DELETE", "/api/links/fall", "secret", nil); status != http.StatusNotFound {
+        t.Errorf("second delete: got status %d", status)
+    }
+}
+
+// codes hands out the given codes in turn.
+func codes(list ...string) CodeGen {
+    var mu sync.Mutex
+    return func(url string, attempt int) (string, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        code := list[0]
+        list = list[1:]
+        return code, nil
+    }
+}
+
+func TestShorten(t *testing.T) {
+    store := NewMemoryStore(nil)
+    // made by hand, it may stop working any time
+    store.Create(Link{Path: "/sale", Url: "https://shop.example.com/sale", Expires: time.Now().Add(time.Hour)})
+    store.Create(Link{Path: "/plain", Url: "https://example.com/plain"})
+    s := NewShortener(store, codes("qr", "a", "a", "b", "c", "d"))
+
+    tests := []struct {
+        url     string
+        path    string
+        created bool
+    }{
+        // /qr is reserved, /a is taken the second time
+        {"https://example.com/1", "/a", true},
+        {"https://example.com/1", "/a", false},
+        {"https://example.com/2", "/b", true},
+        {"https://shop.example.com/sale", "/c", true},
+        {"https://shop.example.com/sale", "/c", false},
+        {"https://example.com/plain", "/d", true},
+    }
+    for _, tt := range tests {
+        l, created, err := s.Shorten(tt.url)
+        if err != nil {
+            t.Fatalf("%s: %s", tt.url, err)
+        }
+        if l.Path != tt.path || created != tt.created || !l.Generated {
+            t.Errorf("%s: got %s (created %v, generated %v), want %s (created %v)", tt.url, l.Path, created, l.Generated, tt.path, tt.created)
+        }
+    }
+
+    // a generated link given limits through the api isn't reused
+    api := APIHandler(store, "secret")
+    r := httptest.NewRequest(http.MethodPut, "/api/links/a", strings.NewReader(`{"url": "https://example.com/1", "maxClicks": 1}`))
+    r.Header.Set("Authorization", "Bearer secret")
+    w := httptest.NewRecorder()
+    api.ServeHTTP(w, r)
+    if w.Code != http.StatusOK {
+        t.Fatalf("update: got status %d: %s", w.Code, w.Body)
+    }
+    s.gen = codes("e")
+    if l, created, err := s.Shorten("https://example.com/1"); err != nil || l.Path != "/e" || !created {
+        t.Errorf("shorten of a limited link's url: got %s, %v, %v, want a new /e", l.Path, created, err)
+    }
+
+    s.gen = codes("x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x", "x")
+    store.Create(Link{Path: "/x", Url: "https://example.com/x"})
+    if _, _, err := s.Shorten("https://example.com/new"); err == nil {
+        t.Error("no error when every code is taken")
+    }
+}
+
+func TestShortenHandler(t *testing.T) {
+    h := ShortenHandler(NewShortener(NewMemoryStore(nil), CounterCodes(4, 0)))
+    tests := []struct {
+        method, contentType, body string
+        status                    int
+        short                     string
+    }{
+        {"POST", "application/json", `{"url": "https://example.com/a"}`, http.StatusCreated, "http://sho.rt/0001"},
+        {"POST", "application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com%2Fa", http.StatusOK, "http://sho.rt/0001"},
+        {"POST", "application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com%2Fb", http.StatusCreated, "http://sho.rt/0002"},
+        {"POST", "application/json", `{"url": "ftp://example.com"}`, http.StatusBadRequest, ""},
+        {"POST", "application/json", `{"url": `, http.StatusBadRequest, ""},
+        {"GET", "", "", http.StatusMethodNotAllowed, ""},
+    }
+    for _, tt := range tests {
+        r := httptest.NewRequest(tt.method, "http://sho.rt/shorten", strings.NewReader(tt.body))
+        if tt.contentType != "" {
+            r.Header.Set("Content-Type", tt.contentType)
+        }
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, r)
+        var got struct{ Short string }
+        json.Unmarshal(w.Body.Bytes(), &got)
+        if w.Code != tt.status || got.Short != tt.short {
+            t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.body, w.Code, got.Short, tt.status, tt.short)
+        }
+    }
+}
+
+func TestStatsHandler(t *testing.T) {
+    at := func(s string) time.Time {
+        tm, err := time.Parse(time.RFC3339, s)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return tm
+    }
+    store := NewMemoryStore(nil)
+    var clicks []Click
+    for _, s := range []string{
+        "2024-04-12T23:59:00Z",
+        "2024-04-15T01:00:00+02:00", // the 14th in UTC
+        "2024-04-14T23:59:59Z",
+        "2024-04-15T00:00:00Z",
+        "2024-04-15T11:59:59Z",
+        "2024-04-15T12:00:00Z",
+        "2024-04-15T12:30:00Z",
+    } {
+        clicks = append(clicks, Click{Path: "/docs", Time: at(s), Referrer: "https://example.com"})
+    }
+    clicks = append(clicks, Click{Path: "/blog"}, Click{Path: "/blog"}, Click{Path: "/home"})
+    store.AddClicks(clicks)
+    now := func() time.Time { return at("2024-04-15T14:30:00+02:00") }
+    h := StatsHandler(store, WithClock(now))
+
+    tests := []struct {
+        query  string
+        starts []string
+        counts []int
+    }{
+        {"", nil, nil}, // 30 days
+        {"bucket=day&n=3", []string{"2024-04-13T00:00:00Z", "2024-04-14T00:00:00Z", "2024-04-15T00:00:00Z"}, []int{0, 2, 4}},
+        {"bucket=hour&n=2", []string{"2024-04-15T11:00:00Z", "2024-04-15T12:00:00Z"}, []int{1, 2}},
+        {"bucket=week&n=1", []string{"2024-04-15T00:00:00Z"}, []int{4}},
+        {"bucket=hour&n=1000", nil, nil},
+    }
+    for _, tt := range tests {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/docs?"+tt.query, nil))
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: got status %d: %s", tt.query, w.Code, w.Body)
+        }
+        var stats struct {
+            Total  int           `json:"total"`
+            Counts []bucketCount `json:"counts"`
+            First  time.Time     `json:"first"`
+            Last   time.Time     `json:"last"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+            t.Fatal(err)
+        }
+        if stats.Total != 7 || !stats.First.Equal(clicks[0].Time) || !stats.Last.Equal(clicks[6].Time) {
+            t.Errorf("%s: got total %d from %s to %s", tt.query, stats.Total, stats.First, stats.Last)
+        }
+        if tt.counts == nil {
+            sum := 0
+            for _, c := range stats.Counts {
+                sum += c.Clicks
+            }
+            if n := len(stats.Counts); (n != 30 && n != 1000) || sum != 7 {
+                t.Errorf("%s: got %d buckets of %d clicks", tt.query, n, sum)
+            }
+            continue
+        }
+        if len(stats.Counts) != len(tt.counts) {
+            t.Fatalf("%s: got buckets %+v, want %d", tt.query, stats.Counts, len(tt.counts))
+        }
+        for i, c := range stats.Counts {
+            if start := at(tt.starts[i]); !c.Start.Equal(start) || c.Clicks != tt.counts[i] {
+                t.Errorf("%s: bucket %d: got %d clicks from %s, want %d from %s", tt.query, i, c.Clicks, c.Start, tt.counts[i], start)
+            }
+        }
+    }
+
+    for _, query := range []string{"bucket=month", "n=0", "n=1001", "n=x"} {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/docs?"+query, nil))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: got status %d, want %d", query, w.Code, http.StatusBadRequest)
+        }
+    }
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats?top=2", nil))
+    var top struct {
+        Top []pathCount `json:"top"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &top); err != nil {
+        t.Fatal(err)
+    }
+    want := []pathCount{{"/docs", 7}, {"/blog", 2}}
+    if fmt.Sprint(top.Top) != fmt.Sprint(want) {
+        t.Errorf("top 2: got %v, want %v", top.Top, want)
+    }
+}
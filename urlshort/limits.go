@@ -0,0 +1,206 @@
+package urlshort
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// Option configures the redirect handlers.
+type Option func(*handlerConfig)
+
+type handlerConfig struct {
+    limiter *ClickLimiter
+    now     func() time.Time
+    hosts   []string // the shortener's own hosts, see WithHosts
+    clicks  ClickStore // for previews, may be nil
+}
+
+func newHandlerConfig(opts []Option) *handlerConfig {
+    c := &handlerConfig{now: time.Now}
+    for _, opt := range opts {
+        opt(c)
+    }
+    if c.limiter == nil {
+        c.limiter = NewClickLimiter(nil)
+    }
+    return c
+}
+
+// WithClickLimiter counts clicks for max-click limits with l, which can
+// be shared by several handlers. Without it every handler counts on its
+// own, from zero.
+func WithClickLimiter(l *ClickLimiter) Option {
+    return func(c *handlerConfig) { c.limiter = l }
+}
+
+// WithClock sets the time used for expiry and not-before times, and for
+// the buckets of StatsHandler.
+func WithClock(now func() time.Time) Option {
+    return func(c *handlerConfig) { c.now = now }
+}
+
+// WithClicks shows the clicks in store on preview pages.
+func WithClicks(store ClickStore) Option {
+    return func(c *handlerConfig) { c.clicks = store }
+}
+
+// ClickLimiter enforces max-click limits. Counts are kept in memory,
+// starting from the clicks already in store (if it isn't nil) the first
+// time a path is limited. Clicks on a pattern are counted together,
+// starting from the stored clicks of every path the pattern serves.
+type ClickLimiter struct {
+    store  ClickStore
+    mu     sync.Mutex
+    counts map[string]int
+}
+
+func NewClickLimiter(store ClickStore) *ClickLimiter {
+    return &ClickLimiter{store: store, counts: make(map[string]int)}
+}
+
+// Allow counts a click on path unless it already had max of them.
+func (l *ClickLimiter) Allow(path string, max int) bool {
+    return l.allow(path, max, nil)
+}
+
+// Count returns the clicks counted on path.
+func (l *ClickLimiter) Count(path string) int {
+    return l.counted(path, nil)
+}
+
+// allow is Allow for a rule. Clicks are stored under the path that was
+// asked for, not the pattern, so serves tells which stored paths count
+// for key. It's nil for exact paths.
+func (l *ClickLimiter) allow(key string, max int, serves func(path string) bool) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    n := l.count(key, serves)
+    if n >= max {
+        return false
+    }
+    l.counts[key] = n + 1
+    return true
+}
+
+// counted is Count for a rule, see allow.
+func (l *ClickLimiter) counted(key string, serves func(path string) bool) int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.count(key, serves)
+}
+
+// count loads the count of key from the store the first time, l.mu
+// must be held.
+func (l *ClickLimiter) count(key string, serves func(path string) bool) int {
+    n, ok := l.counts[key]
+    if ok || l.store == nil {
+        return n
+    }
+    n, err := l.stored(key, serves)
+    if err != nil {
+        log.Printf("error counting clicks of %s: %s\n", key, err)
+    }
+    l.counts[key] = n
+    return n
+}
+
+func (l *ClickLimiter) stored(key string, serves func(path string) bool) (int, error) {
+    if serves == nil {
+        clicks, err := l.store.Clicks(key)
+        return len(clicks), err
+    }
+    counts, err := l.store.ClickCounts()
+    if err != nil {
+        return 0, err
+    }
+    n := 0
+    for path, c := range counts {
+        if serves(path) {
+            n += c
+        }
+    }
+    return n, nil
+}
+
+// the statuses a link may redirect with, 302 if it doesn't say
+var redirectStatuses = map[int]bool{
+    http.StatusMovedPermanently:  true,
+    http.StatusFound:             true,
+    http.StatusTemporaryRedirect: true,
+    http.StatusPermanentRedirect: true,
+}
+
+// target is a redirect found by a handler, with its per link settings.
+type target struct {
+    path      string // the short path clicks are counted for
+    url       string
+    query     QueryPolicy
+    status    int
+    notBefore time.Time
+    expires   time.Time
+    maxClicks int
+    // for patterns, whether the rule is the one serving a path, see
+    // ClickLimiter.allow
+    serves func(path string) bool
+    // shown on previews
+    owner        string
+    created      time.Time
+    source       string
+    interstitial bool // warn before leaving for another host
+}
+
+// validateLimits checks the per link settings shared by files and stores.
+func validateLimits(status int, notBefore, expires time.Time, maxClicks int) error {
+    if status != 0 && !redirectStatuses[status] {
+        return fmt.Errorf("status %d must be 301, 302, 307 or 308", status)
+    }
+    if !notBefore.IsZero() && !expires.IsZero() && !notBefore.Before(expires) {
+        return fmt.Errorf("not-before time %s must be before the expiry time %s", notBefore, expires)
+    }
+    if maxClicks < 0 {
+        return fmt.Errorf("max clicks %d can't be negative", maxClicks)
+    }
+    return nil
+}
+
+// serve redirects to t unless it isn't active: links before their
+// not-before time are not found yet, expired links and links out of
+// clicks are gone. r is without the flags, see readFlags.
+func (c *handlerConfig) serve(w http.ResponseWriter, r *http.Request, t target, f flags, fallback http.Handler) {
+    if f.preview {
+        c.preview(w, r, t)
+        return
+    }
+    now := c.now()
+    switch {
+    case !t.notBefore.IsZero() && now.Before(t.notBefore):
+        http.Error(w, "This link isn't active yet.", http.StatusNotFound)
+        return
+    case !t.expires.IsZero() && !now.Before(t.expires):
+        http.Error(w, "This link has expired.", http.StatusGone)
+        return
+    }
+    dest, err := Destination(r.URL, t.url, t.query)
+    if err != nil {
+        // error parsing long url
+        log.Printf("error parsing long url %s. possibly invalid format.\n", t.url)
+        fallback.ServeHTTP(w,r)
+        return
+    }
+    if t.interstitial && !f.confirmed && c.external(dest) {
+        c.interstitial(w, r, dest)
+        return
+    }
+    if t.maxClicks > 0 && !c.limiter.allow(t.path, t.maxClicks, t.serves) {
+        http.Error(w, "This link has been used up.", http.StatusGone)
+        return
+    }
+    status := t.status
+    if status == 0 {
+        status = http.StatusFound
+    }
+    http.Redirect(w, r, dest.String(), status)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+    "embed"
+    "flag"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    "urlshort"
+)
+
+// built in redirects, after everything else
+//go:embed defaults
+var defaults embed.FS
+
+// the defaults in order of precedence
+var defaultFiles = []string{"defaults/defaults.xml", "defaults/defaults.json", "defaults/defaults.yaml"}
+
+var defaultMap = map[string]string{
+    "/urlshort-godoc": "https://godoc.org/github.com/gophercises/urlshort",
+    "/yaml-godoc":     "https://godoc.org/gopkg.in/yaml.v2",
+}
+
+// fileList is a flag that can be given more than once.
+type fileList []string
+
+func (l *fileList) String() string {
+    return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(s string) error {
+    *l = append(*l, s)
+    return nil
+}
+
+// sources are the flags saying where redirects come from, shared by the
+// server and the commands that inspect it.
+type sources struct {
+    files fileList
+    store *string
+    hosts *string
+}
+
+func sourceFlags(fs *flag.FlagSet) *sources {
+    s := &sources{}
+    fs.Var(&s.files, "file", "a yaml, json, xml, toml, csv or .env style file of (path-url) redirection pairs, or a directory of them. "+
+        "can be given more than once, earlier files win over later ones")
+    s.store = fs.String(
+        "store",
+        "memory",
+        "where links created through the api are kept: memory, bolt:<file> or a postgres:// url",
+    )
+    s.hosts = fs.String("hosts", "localhost:8080,127.0.0.1:8080", "comma separated hosts the shortener is reached on, redirects back to them are checked for loops")
+    return s
+}
+
+// router loads the sources in order of precedence: links from the store
+// come first, then the files and the defaults.
+func (s *sources) router(store urlshort.Store, fallback http.Handler, opts ...urlshort.Option) (*urlshort.Router, error) {
+    opts = append(opts, urlshort.WithHosts(strings.Split(*s.hosts, ",")...))
+    rt := urlshort.NewRouter(fallback, opts...)
+    rt.AddStore("store "+storeName(*s.store), store)
+    for _, f := range s.files {
+        if err := rt.AddPath(f); err != nil {
+            return nil, err
+        }
+    }
+    for _, name := range defaultFiles {
+        b, err := defaults.ReadFile(name)
+        if err != nil {
+            return nil, err
+        }
+        if err := rt.AddData("built in "+name, b); err != nil {
+            return nil, err
+        }
+    }
+    rt.AddMap("built in map", defaultMap)
+    return rt, nil
+}
+
+// storeName is spec without a postgres password.
+func storeName(spec string) string {
+    if i := strings.Index(spec, "@"); i >= 0 && strings.Contains(spec, "://") {
+        return spec[:strings.Index(spec, "://")+3] + "..." + spec[i:]
+    }
+    return spec
+}
+
+// inspect parses the source flags of a command and loads the router.
+func inspect(name, usage string, args []string) (*urlshort.Router, []string) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "usage: urlshort %s [flags] %s\n", name, usage)
+        fs.PrintDefaults()
+    }
+    src := sourceFlags(fs)
+    fs.Parse(args)
+    store, err := openStore(*src.store)
+    if err != nil {
+        exit(fmt.Sprintf("Unable to open store %s: %s", *src.store, err))
+    }
+    rt, err := src.router(store, http.NotFoundHandler())
+    if err != nil {
+        exit(err)
+    }
+    return rt, fs.Args()
+}
+
+// resolveCmd shows where each path goes and which source sends it there.
+func resolveCmd(args []string) {
+    rt, paths := inspect("resolve", "/path...", args)
+    if len(paths) == 0 {
+        exit("usage: urlshort resolve [flags] /path...")
+    }
+    missing := false
+    for _, path := range paths {
+        routes, err := rt.Resolve(path)
+        if err != nil {
+            exit(err)
+        }
+        if len(routes) == 0 {
+            fmt.Printf("%s: not found\n", path)
+            missing = true
+            continue
+        }
+        fmt.Printf("%s -> %s\n", path, routes[0].Url)
+        fmt.Printf("    from %s (%s)\n", routes[0].Source, routes[0].Path)
+        for _, r := range routes[1:] {
+            fmt.Printf("    overrides %s (%s) -> %s\n", r.Source, r.Path, r.Url)
+        }
+    }
+    if missing {
+        os.Exit(1)
+    }
+}
+
+// listCmd prints every route with its source, marking shadowed ones.
+func listCmd(args []string) {
+    rt, _ := inspect("list", "", args)
+    listings, err := rt.List()
+    if err != nil {
+        exit(err)
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "PATH\tURL\tSOURCE")
+    for _, l := range listings {
+        src := l.Source
+        if l.ShadowedBy != "" {
+            src += " (shadowed by " + l.ShadowedBy + ")"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\n", l.Path, l.Url, src)
+    }
+    w.Flush()
+}
@@ -4,108 +4,125 @@ import (
 	"fmt"
 	"os"
 	"net/http"
-	"path/filepath"
 	"flag"
+	"strings"
+	"database/sql"
+	"os/signal"
+	"syscall"
+	"time"
 
+	_ "github.com/lib/pq"
 	"urlshort"
 )
 
+// subcommands, anything else runs the server
+var commands = map[string]func(args []string){
+    "resolve": resolveCmd,
+    "list":    listCmd,
+}
+
 func main() {
+    if len(os.Args) > 1 {
+        if cmd, ok := commands[os.Args[1]]; ok {
+            cmd(os.Args[2:])
+            return
+        }
+    }
+
 	mux := defaultMux()
 
-    // file flag: Allows user to submit addition path-url redirection pairs
-    // in either yaml, json, or xml format
-    m := `Input yaml, json, or xml file denoting (path-url)
-redirection pairs for url shortener`
-    inputFile := flag.String("file", "", m)
+    src := sourceFlags(flag.CommandLine)
+    token := flag.String(
+        "token",
+        os.Getenv("URLSHORT_TOKEN"),
+        "bearer token for the /api/links management api. defaults to $URLSHORT_TOKEN, empty disables the api",
+    )
+    reload := flag.Duration("reload", 2*time.Second, "how often to check -file for changes, 0 to never reload it")
+    codes := flag.String("codes", "counter", "how POST /shorten makes codes: counter, random or hash")
+    codeLength := flag.Int("code-length", 6, "length of generated codes (counter codes grow past it when they run out)")
+    privateShorten := flag.Bool("private-shorten", false, "require the -token for POST /shorten too, anyone may shorten otherwise")
     flag.Parse()
 
-    // yaml, json, and xml default values
-	yaml := `
-- path: /urlshort
-  url: https://github.com/gophercises/urlshort
-- path: /urlshort-final
-  url: https://github.com/gophercises/urlshort/tree/solution
-`
-    json := `
-[
-    {
-        "path": "/fall",
-        "url": "https://youtu.be/QhBoFEq0lU0"
-    },
-    {
-        "path": "/feels",
-        "url": "https://soundcloud.com/makzo/shanti"
+    store, err := openStore(*src.store)
+    if err != nil {
+        exit(fmt.Sprintf("Unable to open store %s: %s", *src.store, err))
+    }
+    // max-click limits count on from the clicks the store already has
+    limiter := urlshort.WithClickLimiter(urlshort.NewClickLimiter(store.(urlshort.ClickStore)))
+    // preview pages show the clicks too
+    router, err := src.router(store, mux, limiter, urlshort.WithClicks(store.(urlshort.ClickStore)))
+    if err != nil {
+        exit(err)
+    }
+    if *reload > 0 {
+        router.Watch(*reload)
     }
-]
-    `
-    xml := `
-<PathsToUrls>
-    <PathToUrl>
-        <Path>/my-gophercises</Path>
-        <Url>https://github.com/pahyde/gophercises</Url>
-    </PathToUrl>
-    <PathToUrl>
-        <Path>/my-urlshort</Path>
-        <Url>https://github.com/pahyde/gophercises/urlshort</Url>
-    </PathToUrl>
-</PathsToUrls>
-    `
-
-	// Build the MapHandler using the mux as the fallback
-	pathsToUrls := map[string]string{
-		"/urlshort-godoc": "https://godoc.org/github.com/gophercises/urlshort",
-		"/yaml-godoc":     "https://godoc.org/gopkg.in/yaml.v2",
-	}
-	mapHandler := urlshort.MapHandler(pathsToUrls, mux)
-
 
-	// Build the XMLHandler -> JSONHandler -> YAMLHandler -> mapHandler as the fallback
-	yamlHandler, err := urlshort.YAMLHandler([]byte(yaml), mapHandler)
-	if err != nil {
-		panic(err)
-	}
-    jsonHandler, err := urlshort.JSONHandler([]byte(json), yamlHandler)
-	if err != nil {
-	    fmt.Println(json)
-		panic(err)
-	}
-	xmlHandler, err := urlshort.XMLHandler([]byte(xml), jsonHandler)
-	if err != nil {
-		panic(err)
-	}
+    if *token != "" {
+        api := urlshort.APIHandler(store, *token)
+        mux.Handle("/api/links", api)
+        mux.Handle("/api/links/", api)
+    }
+    gen, err := urlshort.NewCodeGen(*codes, *codeLength, store)
+    if err != nil {
+        exit(err)
+    }
+    var shorten http.Handler = urlshort.ShortenHandler(urlshort.NewShortener(store, gen))
+    if *privateShorten {
+        shorten = urlshort.RequireToken(*token, shorten)
+    }
+    mux.Handle("/shorten", shorten)
 
-    entryPoint := xmlHandler
-    if *inputFile != "" {
-        h, err := getHandlerFromFile(*inputFile, xmlHandler)
-        if err != nil {
-            exit(err)
-        }
-        entryPoint = h
+    // every store keeps clicks too
+    clicks := urlshort.NewAnalytics(store.(urlshort.ClickStore))
+    var stats http.Handler = urlshort.StatsHandler(store.(urlshort.ClickStore))
+    if *token != "" {
+        stats = urlshort.RequireToken(*token, stats)
     }
+    mux.Handle("/stats", stats)
+    mux.Handle("/stats/", stats)
+    mux.Handle("/qr/", urlshort.QRHandler(router))
+    // the shortener's own pages go first, so no link or rule can take
+    // them over
+    app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if urlshort.Reserved(r.URL.Path) {
+            mux.ServeHTTP(w, r)
+            return
+        }
+        router.ServeHTTP(w, r)
+    })
+    entryPoint := clicks.Track(app)
+
+    // flush the queued clicks before exiting on ctrl-c
+    sig := make(chan os.Signal, 1)
+    signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-sig
+        clicks.Close()
+        os.Exit(0)
+    }()
 
 	// start the server
 	fmt.Println("Starting the server on :8080")
 	http.ListenAndServe(":8080", entryPoint)
 }
 
-func getHandlerFromFile(filename string, fallback http.Handler) (http.HandlerFunc, error) {
-    b, err := os.ReadFile(filename)
-    if err != nil {
-        return nil, fmt.Errorf("Unable to read file %s", filename)
-    }
-    ext := filepath.Ext(filename)
-    switch ext {
-    case ".yaml":
-        return urlshort.YAMLHandler(b, fallback)
-    case ".json":
-        return urlshort.JSONHandler(b, fallback)
-    case ".xml":
-        return urlshort.XMLHandler(b, fallback)
+// openStore opens the store described by spec, see the -store flag.
+func openStore(spec string) (urlshort.Store, error) {
+    switch {
+    case spec == "memory":
+        return urlshort.NewMemoryStore(nil), nil
+    case strings.HasPrefix(spec, "bolt:"):
+        return urlshort.OpenBoltStore(strings.TrimPrefix(spec, "bolt:"))
+    case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+        db, err := sql.Open("postgres", spec)
+        if err != nil {
+            return nil, err
+        }
+        return urlshort.NewSQLStore(db)
     default:
-        return nil, fmt.Errorf("Invalid file extention: %s\nMust be json, yaml, or xml.", ext)
+        return nil, fmt.Errorf("unknown store, must be memory, bolt:<file> or a postgres:// url")
     }
-
 }
 
 func exit(m any) {
@@ -0,0 +1,170 @@
+package urlshort
+
+import (
+    _ "embed"
+    "fmt"
+    "html/template"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Any short path can be previewed instead of followed, by adding a + or
+// a ?preview query: /fall+ or /fall?preview shows a page with where the
+// link goes, who owns it, when it was made and how often it was used.
+//
+// Links can also ask for an interstitial, a page warning that the link
+// leaves the shortener's hosts (see WithHosts) before going there. Both
+// pages continue with ?go, which skips the interstitial.
+
+//go:embed preview.html
+var previewHTML string
+
+var previewTemplates = template.Must(template.New("preview").Parse(previewHTML))
+
+const (
+    previewFlag = "preview"
+    goFlag      = "go"
+)
+
+// flags are what a request asks of a link besides following it.
+type flags struct {
+    preview   bool
+    confirmed bool // past the interstitial
+}
+
+// readFlags takes the preview suffix and the preview and go queries off
+// r, so they don't end up at the destination. Only bare ?preview and ?go
+// count, ?go=home is left alone.
+func readFlags(r *http.Request) (*http.Request, flags) {
+    var f flags
+    u := *r.URL
+    if len(u.Path) > 1 && strings.HasSuffix(u.Path, "+") {
+        f.preview = true
+        u.Path = strings.TrimSuffix(u.Path, "+")
+        u.RawPath = ""
+    }
+    if u.RawQuery != "" {
+        var kept []string
+        for _, kv := range strings.Split(u.RawQuery, "&") {
+            switch kv {
+            case previewFlag:
+                f.preview = true
+            case goFlag:
+                f.confirmed = true
+            default:
+                kept = append(kept, kv)
+            }
+        }
+        u.RawQuery = strings.Join(kept, "&")
+    }
+    if u == *r.URL {
+        return r, f
+    }
+    r2 := new(http.Request)
+    *r2 = *r
+    r2.URL = &u
+    return r2, f
+}
+
+// continueURL is where the pages go on to: the link itself, past the
+// interstitial.
+func continueURL(r *http.Request) string {
+    u := *r.URL
+    if u.RawQuery == "" {
+        u.RawQuery = goFlag
+    } else {
+        u.RawQuery += "&" + goFlag
+    }
+    return u.RequestURI()
+}
+
+// external reports whether dest leaves the shortener's own hosts.
+func (c *handlerConfig) external(dest *url.URL) bool {
+    for _, h := range c.hosts {
+        if strings.EqualFold(h, dest.Host) {
+            return false
+        }
+    }
+    return true
+}
+
+type previewPage struct {
+    Title       string
+    Path        string
+    Url         string
+    Destination string
+    Host        string // of the shortener
+    Continue    string
+    State       string // why the link doesn't work now, if it doesn't
+    Owner       string
+    Created     time.Time
+    HasClicks   bool
+    Clicks      int
+    Status      int
+    Source      string
+    Rule        string // the path or pattern that matched
+}
+
+// preview shows where t goes. It works for links that are expired or
+// not active yet too, the page says so.
+func (c *handlerConfig) preview(w http.ResponseWriter, r *http.Request, t target) {
+    p := previewPage{
+        Title:    "Preview of " + r.URL.Path,
+        Path:     r.URL.Path,
+        Url:      t.url,
+        Host:     r.Host,
+        Continue: continueURL(r),
+        Owner:    t.owner,
+        Created:  t.created,
+        Status:   t.status,
+        Source:   t.source,
+        Rule:     t.path,
+    }
+    if p.Status == 0 {
+        p.Status = http.StatusFound
+    }
+    if dest, err := Destination(r.URL, t.url, t.query); err == nil {
+        p.Destination = dest.String()
+    }
+    if c.clicks != nil {
+        clicks, err := c.clicks.Clicks(r.URL.Path)
+        if err != nil {
+            log.Printf("error counting clicks of %s: %s\n", r.URL.Path, err)
+        } else {
+            p.HasClicks, p.Clicks = true, len(clicks)
+        }
+    }
+    now := c.now()
+    switch {
+    case !t.notBefore.IsZero() && now.Before(t.notBefore):
+        p.State = "This link isn't active until " + t.notBefore.Format(time.RFC1123) + "."
+    case !t.expires.IsZero() && !now.Before(t.expires):
+        p.State = "This link expired on " + t.expires.Format(time.RFC1123) + "."
+    case t.maxClicks > 0 && c.limiter.counted(t.path, t.serves) >= t.maxClicks:
+        p.State = fmt.Sprintf("This link has been used up, it only works %d times.", t.maxClicks)
+    }
+    render(w, "preview", p)
+}
+
+// interstitial warns that dest is outside the shortener.
+func (c *handlerConfig) interstitial(w http.ResponseWriter, r *http.Request, dest *url.URL) {
+    render(w, "interstitial", previewPage{
+        Title:       "Leaving " + r.Host,
+        Path:        r.URL.Path,
+        Destination: dest.String(),
+        Host:        r.Host,
+        Continue:    continueURL(r),
+    })
+}
+
+func render(w http.ResponseWriter, name string, p previewPage) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    // pages change with the link, don't let them be kept around
+    w.Header().Set("Cache-Control", "no-store")
+    if err := previewTemplates.ExecuteTemplate(w, name, p); err != nil {
+        log.Printf("error rendering %s page: %s\n", name, err)
+    }
+}
@@ -0,0 +1,121 @@
+package urlshort
+
+import (
+    "bytes"
+    "fmt"
+    "net/http"
+    "strings"
+
+    qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+    defaultQRSize = 256
+    minQRSize     = 64
+    maxQRSize     = 2048
+)
+
+// error correction levels, the share of the code that can be damaged
+// (or covered by a logo) and still be read
+var qrLevels = map[string]qrcode.RecoveryLevel{
+    "L": qrcode.Low,     // 7%
+    "M": qrcode.Medium,  // 15%
+    "Q": qrcode.High,    // 25%
+    "H": qrcode.Highest, // 30%
+}
+
+// QRHandler serves QR codes of short links:
+//
+//     GET /qr/<path>?format=png&size=256&level=M
+//
+// format is png (the default) or svg, size is the width in pixels
+// (64 to 2048, for svg the size it's drawn at) and level the error
+// correction: L, M (the default), Q or H. The code holds the short url on
+// the host of the request, so it's only made for paths rt resolves.
+func QRHandler(rt *Router) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            w.Header().Set("Allow", "GET, HEAD")
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        path := strings.TrimPrefix(r.URL.EscapedPath(), "/qr")
+        if path == "" || path == "/" {
+            http.Error(w, "usage: /qr/<path>", http.StatusNotFound)
+            return
+        }
+        routes, err := rt.Resolve(path)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if len(routes) == 0 {
+            http.NotFound(w, r)
+            return
+        }
+
+        size, ok := intParam(r, "size", defaultQRSize)
+        if !ok || size < minQRSize || size > maxQRSize {
+            http.Error(w, fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize), http.StatusBadRequest)
+            return
+        }
+        levelName := strings.ToUpper(r.URL.Query().Get("level"))
+        if levelName == "" {
+            levelName = "M"
+        }
+        level, ok := qrLevels[levelName]
+        if !ok {
+            http.Error(w, "level must be L, M, Q or H", http.StatusBadRequest)
+            return
+        }
+        q, err := qrcode.New(baseURL(r)+path, level)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        var body []byte
+        switch format := r.URL.Query().Get("format"); format {
+        case "", "png":
+            body, err = q.PNG(size)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            w.Header().Set("Content-Type", "image/png")
+        case "svg":
+            body = qrSVG(q.Bitmap(), size)
+            w.Header().Set("Content-Type", "image/svg+xml")
+        default:
+            http.Error(w, "format must be png or svg", http.StatusBadRequest)
+            return
+        }
+        w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+        w.Write(body)
+    }
+}
+
+// qrSVG draws the modules of a code, quiet zone included, as one path
+// scaled to size pixels.
+func qrSVG(bitmap [][]bool, size int) []byte {
+    n := len(bitmap)
+    var b bytes.Buffer
+    fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+    fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+    for y, row := range bitmap {
+        for x := 0; x < len(row); x++ {
+            if !row[x] {
+                continue
+            }
+            // one run of dark modules per segment
+            start := x
+            for x < len(row) && row[x] {
+                x++
+            }
+            fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+        }
+    }
+    b.WriteString(`"/></svg>`)
+    b.WriteByte('\n')
+    return b.Bytes()
+}
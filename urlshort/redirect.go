@@ -0,0 +1,66 @@
+package urlshort
+
+import (
+    "fmt"
+    "net/url"
+)
+
+// QueryPolicy decides what happens to the query string of a request when
+// it's redirected to a url that may have a query of its own.
+//
+//     append    the url's query, then the request's (the default)
+//     override  the url's query, with parameters the request also has
+//               replaced by the request's values
+//     keep      only the url's query, the request's is dropped
+//     drop      no query at all
+//
+// The url's scheme, host, path and fragment are always kept.
+type QueryPolicy string
+
+const (
+    QueryAppend   QueryPolicy = "append"
+    QueryOverride QueryPolicy = "override"
+    QueryKeep     QueryPolicy = "keep"
+    QueryDrop     QueryPolicy = "drop"
+)
+
+// Validate accepts the policies above and "" for the default.
+func (p QueryPolicy) Validate() error {
+    switch p {
+    case "", QueryAppend, QueryOverride, QueryKeep, QueryDrop:
+        return nil
+    }
+    return fmt.Errorf("unknown query policy %q. Must be append, override, keep or drop.", string(p))
+}
+
+// Destination is where a request for req is sent when it's redirected
+// to urlstr.
+func Destination(req *url.URL, urlstr string, policy QueryPolicy) (*url.URL, error) {
+    dest, err := url.Parse(urlstr)
+    if err != nil {
+        return nil, err
+    }
+    // don't touch the parsed url's query, it may be shared by callers
+    out := *dest
+    switch policy {
+    case QueryKeep:
+    case QueryDrop:
+        out.RawQuery = ""
+        out.ForceQuery = false
+    case QueryOverride:
+        q := dest.Query()
+        for k, vs := range req.Query() {
+            q[k] = vs
+        }
+        out.RawQuery = q.Encode()
+    default:
+        switch {
+        case req.RawQuery == "":
+        case dest.RawQuery == "":
+            out.RawQuery = req.RawQuery
+        default:
+            out.RawQuery = dest.RawQuery + "&" + req.RawQuery
+        }
+    }
+    return &out, nil
+}
@@ -0,0 +1,128 @@
+package urlshort
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// FileHandler serves the redirects of a file in any format and can
+// watch the file for changes. A changed file is only swapped in once it
+// parses, until then the old redirects keep being served.
+type FileHandler struct {
+    filename string
+    fallback http.Handler
+    config   *handlerConfig // shared by every version, so click counts carry over
+    current  atomic.Value // *ruleSet of the last good version of the file
+
+    mu      sync.Mutex // guards modTime and size
+    modTime time.Time
+    size    int64
+
+    stop     chan struct{}
+    stopOnce sync.Once
+}
+
+// NewFileHandler loads filename, which has to parse. The format is picked
+// by the file extension or, for other extensions, by sniffing the
+// contents, see RegisterFormat.
+func NewFileHandler(filename string, fallback http.Handler, opts ...Option) (*FileHandler, error) {
+    return newFileHandler(filename, fallback, newHandlerConfig(opts))
+}
+
+func newFileHandler(filename string, fallback http.Handler, c *handlerConfig) (*FileHandler, error) {
+    h := &FileHandler{
+        filename: filename,
+        fallback: fallback,
+        config:   c,
+        stop:     make(chan struct{}),
+    }
+    if _, err := h.Reload(); err != nil {
+        return nil, err
+    }
+    return h, nil
+}
+
+func (h *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    rulesHandler(h.rules(), h.fallback, h.config).ServeHTTP(w, r)
+}
+
+func (h *FileHandler) rules() *ruleSet {
+    return h.current.Load().(*ruleSet)
+}
+
+func (h *FileHandler) name() string {
+    return h.filename
+}
+
+func (h *FileHandler) resolve(u *url.URL) (target, bool, error) {
+    t, ok := h.rules().resolve(u)
+    return t, ok, nil
+}
+
+func (h *FileHandler) routes() ([]Route, error) {
+    return h.rules().routes(h.filename), nil
+}
+
+// Reload reads the file again if it changed since it was last read.
+// changed reports whether new redirects were swapped in.
+func (h *FileHandler) Reload() (changed bool, err error) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    info, err := os.Stat(h.filename)
+    if err != nil {
+        return false, err
+    }
+    if info.ModTime().Equal(h.modTime) && info.Size() == h.size {
+        return false, nil
+    }
+    b, err := os.ReadFile(h.filename)
+    if err != nil {
+        return false, fmt.Errorf("Unable to read file %s", h.filename)
+    }
+    // remember the version even if it's broken so it's only reported once
+    h.modTime, h.size = info.ModTime(), info.Size()
+    d, err := decoderFor(h.filename, b)
+    if err != nil {
+        return false, err
+    }
+    rs, err := parseRules(b, d, h.config)
+    if err != nil {
+        return false, fmt.Errorf("%s: %w", h.filename, err)
+    }
+    h.current.Store(rs)
+    return true, nil
+}
+
+// Watch checks the file for changes every interval until Close is
+// called. Errors are logged and the previous redirects kept.
+func (h *FileHandler) Watch(interval time.Duration) {
+    go func() {
+        t := time.NewTicker(interval)
+        defer t.Stop()
+        for {
+            select {
+            case <-h.stop:
+                return
+            case <-t.C:
+            }
+            changed, err := h.Reload()
+            switch {
+            case err != nil:
+                log.Printf("not reloading %s, keeping the previous redirects: %s\n", h.filename, err)
+            case changed:
+                log.Printf("reloaded %s\n", h.filename)
+            }
+        }
+    }()
+}
+
+// Close stops watching the file.
+func (h *FileHandler) Close() {
+    h.stopOnce.Do(func() { close(h.stop) })
+}
@@ -0,0 +1,256 @@
+package urlshort
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// Route is a redirect as a source has it. Path may be a pattern, see
+// ruleKind.
+type Route struct {
+    Source string `json:"source"`
+    Path   string `json:"path"`
+    Url    string `json:"url"`
+}
+
+// a source is one place redirects come from: a file, built in data or a
+// store
+type source interface {
+    name() string
+    resolve(u *url.URL) (target, bool, error)
+    routes() ([]Route, error)
+}
+
+// Router serves redirects from any number of sources. Sources are asked
+// in the order they were added, so when several have a path the one
+// added first wins.
+type Router struct {
+    sources  []source
+    files    []*FileHandler
+    fallback http.Handler
+    config   *handlerConfig
+}
+
+// NewRouter returns a Router without sources, sending every request to
+// fallback until some are added. The options apply to all sources.
+func NewRouter(fallback http.Handler, opts ...Option) *Router {
+    return &Router{fallback: fallback, config: newHandlerConfig(opts)}
+}
+
+// AddFile adds a file in any format, see NewFileHandler.
+func (rt *Router) AddFile(filename string) error {
+    h, err := newFileHandler(filename, rt.fallback, rt.config)
+    if err != nil {
+        return err
+    }
+    rt.sources = append(rt.sources, h)
+    rt.files = append(rt.files, h)
+    return nil
+}
+
+// AddDir adds the files in dir with the extension of a format, in order
+// of their names. Other files and subdirectories are skipped. Files created after
+// the directory was added are not picked up.
+func (rt *Router) AddDir(dir string) error {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return err
+    }
+    // ReadDir sorts by name
+    for _, e := range entries {
+        if e.IsDir() {
+            continue
+        }
+        if _, ok := decoderByExt(e.Name()); !ok {
+            continue
+        }
+        if err := rt.AddFile(filepath.Join(dir, e.Name())); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// AddPath adds path with AddDir if it's a directory, AddFile otherwise.
+func (rt *Router) AddPath(path string) error {
+    info, err := os.Stat(path)
+    if err != nil {
+        return err
+    }
+    if info.IsDir() {
+        return rt.AddDir(path)
+    }
+    return rt.AddFile(path)
+}
+
+// AddData adds redirects that don't change, like built in defaults. The
+// format is picked by name and data, as for files.
+func (rt *Router) AddData(name string, data []byte) error {
+    d, err := decoderFor(name, data)
+    if err != nil {
+        return err
+    }
+    rs, err := parseRules(data, d, rt.config)
+    if err != nil {
+        return fmt.Errorf("%s: %w", name, err)
+    }
+    rt.sources = append(rt.sources, dataSource{n: name, rs: rs})
+    return nil
+}
+
+// AddMap adds pathsToUrls, see MapHandler.
+func (rt *Router) AddMap(name string, pathsToUrls map[string]string) {
+    rt.AddStore(name, NewMemoryStore(pathsToUrls))
+}
+
+// AddStore adds the links of store, which may change while the router
+// runs.
+func (rt *Router) AddStore(name string, store Store) {
+    rt.sources = append(rt.sources, storeSource{n: name, store: store})
+}
+
+// Watch reloads changed files every interval, see FileHandler.Watch.
+func (rt *Router) Watch(interval time.Duration) {
+    for _, h := range rt.files {
+        h.Watch(interval)
+    }
+}
+
+// Close stops watching the files.
+func (rt *Router) Close() {
+    for _, h := range rt.files {
+        h.Close()
+    }
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    req, f := readFlags(r)
+    for _, s := range rt.sources {
+        t, ok, err := s.resolve(req.URL)
+        if err != nil {
+            log.Printf("error looking up %s in %s: %s\n", req.URL.Path, s.name(), err)
+            continue
+        }
+        if ok {
+            t.source = s.name()
+            rt.config.serve(w, req, t, f, rt.fallback)
+            return
+        }
+    }
+    rt.fallback.ServeHTTP(w, r)
+}
+
+// Resolve returns every source with a redirect for path, in order of
+// precedence: the first one is the one served. Url is where the
+// redirect goes, with patterns filled in.
+func (rt *Router) Resolve(path string) ([]Route, error) {
+    u, err := url.Parse(path)
+    if err != nil {
+        return nil, err
+    }
+    var found []Route
+    for _, s := range rt.sources {
+        t, ok, err := s.resolve(u)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", s.name(), err)
+        }
+        if !ok {
+            continue
+        }
+        dest, err := Destination(u, t.url, t.query)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", s.name(), err)
+        }
+        found = append(found, Route{Source: s.name(), Path: t.path, Url: dest.String()})
+    }
+    return found, nil
+}
+
+// Listing is a route and, if an earlier source has the same path, the
+// source that wins over it.
+type Listing struct {
+    Route
+    ShadowedBy string `json:"shadowedBy,omitempty"`
+}
+
+// List returns the routes of every source, sorted by path and then by
+// precedence. Only routes with the very same path shadow each other,
+// use Resolve to see which pattern a request matches.
+func (rt *Router) List() ([]Listing, error) {
+    var all []Listing
+    winner := make(map[string]string)
+    for _, s := range rt.sources {
+        routes, err := s.routes()
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", s.name(), err)
+        }
+        for _, r := range routes {
+            l := Listing{Route: r}
+            if w, ok := winner[r.Path]; ok {
+                l.ShadowedBy = w
+            } else {
+                winner[r.Path] = s.name()
+            }
+            all = append(all, l)
+        }
+    }
+    sort.SliceStable(all, func(i, j int) bool { return all[i].Path < all[j].Path })
+    return all, nil
+}
+
+type dataSource struct {
+    n  string
+    rs *ruleSet
+}
+
+func (s dataSource) name() string {
+    return s.n
+}
+
+func (s dataSource) resolve(u *url.URL) (target, bool, error) {
+    t, ok := s.rs.resolve(u)
+    return t, ok, nil
+}
+
+func (s dataSource) routes() ([]Route, error) {
+    return s.rs.routes(s.n), nil
+}
+
+type storeSource struct {
+    n     string
+    store Store
+}
+
+func (s storeSource) name() string {
+    return s.n
+}
+
+func (s storeSource) resolve(u *url.URL) (target, bool, error) {
+    link, err := s.store.Get(u.Path)
+    if errors.Is(err, ErrNotFound) {
+        return target{}, false, nil
+    }
+    if err != nil {
+        return target{}, false, err
+    }
+    return link.target(), true, nil
+}
+
+func (s storeSource) routes() ([]Route, error) {
+    links, err := s.store.List()
+    if err != nil {
+        return nil, err
+    }
+    routes := make([]Route, 0, len(links))
+    for _, l := range links {
+        routes = append(routes, Route{Source: s.n, Path: l.Path, Url: l.Url})
+    }
+    return routes, nil
+}
@@ -0,0 +1,280 @@
+package urlshort
+
+import (
+    "fmt"
+    "net/url"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Paths in redirect files are rules. Besides exact paths there are three
+// kinds of patterns, whose matches can be put into the url as {name}:
+//
+//     /gh/{user}/{repo}   each {name} matches one path segment
+//     /docs/*             a prefix, the rest of the path is {*}
+//     ~/issue/(\d+)       a regular expression matching the whole path,
+//                         captures are {1}, {2}, ... or {name} for
+//                         (?P<name>...) groups
+//
+// When several rules match a path the most specific one wins: exact paths
+// first, then {name} rules with the most literal segments, then the
+// longest prefix, then regular expressions. Ties go to the rule that
+// comes first in the file.
+type ruleKind int
+
+const (
+    exactRule ruleKind = iota
+    paramRule
+    prefixRule
+    regexRule
+)
+
+type rule struct {
+    target
+    kind   ruleKind
+    index  int    // position in the file
+    re     *regexp.Regexp // param and regex rules
+    prefix string         // prefix rules
+    // literal segments of a param rule
+    literals int
+}
+
+var (
+    paramName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+    placeholder = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+func compileRule(index int, p PathToUrl) (rule, error) {
+    r := rule{index: index, target: target{
+        path:         p.Path,
+        url:          p.Url,
+        query:        p.Query,
+        status:       p.Status,
+        notBefore:    p.NotBefore,
+        expires:      p.Expires,
+        maxClicks:    p.MaxClicks,
+        owner:        p.Owner,
+        interstitial: p.Interstitial,
+    }}
+    if !strings.HasPrefix(p.Path, "/") && !strings.HasPrefix(p.Path, "~") {
+        return r, fmt.Errorf("path %q must start with /", p.Path)
+    }
+    // placeholders are checked below, the rest of the url has to be valid
+    if _, err := validateURL(placeholder.ReplaceAllString(p.Url, "x")); err != nil {
+        return r, err
+    }
+    if err := p.Query.Validate(); err != nil {
+        return r, err
+    }
+    if err := validateLimits(p.Status, p.NotBefore, p.Expires, p.MaxClicks); err != nil {
+        return r, err
+    }
+    var vars []string
+    switch {
+    case strings.HasPrefix(p.Path, "~"):
+        re, err := regexp.Compile("^(?:" + p.Path[1:] + ")$")
+        if err != nil {
+            return r, fmt.Errorf("invalid path pattern %q: %w", p.Path, err)
+        }
+        r.kind, r.re = regexRule, re
+        for i, name := range re.SubexpNames() {
+            if i > 0 {
+                vars = append(vars, strconv.Itoa(i))
+            }
+            if name != "" {
+                vars = append(vars, name)
+            }
+        }
+    case strings.HasSuffix(p.Path, "/*"):
+        r.kind, r.prefix = prefixRule, strings.TrimSuffix(p.Path, "*")
+        vars = []string{"*"}
+    case strings.Contains(p.Path, "{"):
+        r.kind = paramRule
+        var expr strings.Builder
+        expr.WriteString("^")
+        for _, seg := range strings.Split(p.Path, "/")[1:] {
+            expr.WriteString("/")
+            if m := placeholder.FindStringSubmatch(seg); m != nil && m[0] == seg {
+                name := m[1]
+                if !paramName.MatchString(name) {
+                    return r, fmt.Errorf("invalid placeholder {%s} in %q", name, p.Path)
+                }
+                for _, v := range vars {
+                    if v == name {
+                        return r, fmt.Errorf("placeholder {%s} appears twice in %q", name, p.Path)
+                    }
+                }
+                vars = append(vars, name)
+                expr.WriteString("(?P<" + name + ">[^/]+)")
+                continue
+            }
+            if strings.ContainsAny(seg, "{}") {
+                return r, fmt.Errorf("placeholders must be whole path segments in %q", p.Path)
+            }
+            r.literals++
+            expr.WriteString(regexp.QuoteMeta(seg))
+        }
+        expr.WriteString("$")
+        r.re = regexp.MustCompile(expr.String())
+    default:
+        return r, nil
+    }
+    // every placeholder in the url has to be filled by the path
+    for _, m := range placeholder.FindAllStringSubmatch(p.Url, -1) {
+        found := false
+        for _, v := range vars {
+            found = found || v == m[1]
+        }
+        if !found {
+            return r, fmt.Errorf("url %q uses {%s}, which path %q doesn't define", p.Url, m[1], p.Path)
+        }
+    }
+    return r, nil
+}
+
+// match reports whether path matches the rule and returns the values of
+// its placeholders.
+func (r rule) match(path string) (map[string]string, bool) {
+    switch r.kind {
+    case exactRule:
+        return nil, path == r.path
+    case prefixRule:
+        if !strings.HasPrefix(path, r.prefix) {
+            return nil, false
+        }
+        return map[string]string{"*": strings.TrimPrefix(path, r.prefix)}, true
+    }
+    m := r.re.FindStringSubmatch(path)
+    if m == nil {
+        return nil, false
+    }
+    vars := make(map[string]string)
+    for i, name := range r.re.SubexpNames() {
+        if i == 0 {
+            continue
+        }
+        if r.kind == regexRule {
+            vars[strconv.Itoa(i)] = m[i]
+        }
+        if name != "" {
+            vars[name] = m[i]
+        }
+    }
+    return vars, true
+}
+
+// expand fills the placeholders of dest with vars.
+func expand(dest string, vars map[string]string) string {
+    if len(vars) == 0 {
+        return dest
+    }
+    return placeholder.ReplaceAllStringFunc(dest, func(s string) string {
+        return vars[s[1:len(s)-1]]
+    })
+}
+
+// ruleSet finds the rule for a path: exact paths are looked up in a map,
+// patterns are tried in order of precedence.
+type ruleSet struct {
+    exact    map[string]rule
+    patterns []rule
+    all      []rule // in file order
+}
+
+// newRuleSet compiles and checks every entry of a file. All the problems
+// found are returned together as a ValidationError. Redirects to hosts,
+// the shortener's own, are checked for loops.
+func newRuleSet(l []PathToUrl, hosts []string) (*ruleSet, error) {
+    rs := &ruleSet{exact: make(map[string]rule)}
+    var errs ValidationError
+    first := make(map[string]int)
+    for i, p := range l {
+        j, dup := first[p.Path]
+        if dup {
+            errs.add(i, p.Path, fmt.Errorf("duplicate path, entry %d has it too", j))
+        } else {
+            first[p.Path] = i
+        }
+        r, err := compileRule(i, p)
+        if err != nil {
+            errs.add(i, p.Path, err)
+        }
+        if dup || err != nil {
+            continue
+        }
+        rs.all = append(rs.all, r)
+        if r.kind == exactRule {
+            rs.exact[r.path] = r
+            continue
+        }
+        rs.patterns = append(rs.patterns, r)
+    }
+    sort.SliceStable(rs.patterns, func(i, j int) bool {
+        a, b := rs.patterns[i], rs.patterns[j]
+        if a.kind != b.kind {
+            return a.kind < b.kind
+        }
+        switch a.kind {
+        case paramRule:
+            if a.literals != b.literals {
+                return a.literals > b.literals
+            }
+        case prefixRule:
+            if len(a.prefix) != len(b.prefix) {
+                return len(a.prefix) > len(b.prefix)
+            }
+        }
+        return a.index < b.index
+    })
+    errs = append(errs, rs.loops(hosts)...)
+    if len(errs) > 0 {
+        sort.SliceStable(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+        return nil, errs
+    }
+    return rs, nil
+}
+
+// lookup returns the rule for u and the url it redirects to. Patterns
+// match the escaped path, so what they capture stays escaped in the url.
+func (rs *ruleSet) lookup(u *url.URL) (rule, string, bool) {
+    if r, ok := rs.exact[u.Path]; ok {
+        return r, r.url, true
+    }
+    path := u.EscapedPath()
+    for _, r := range rs.patterns {
+        if vars, ok := r.match(path); ok {
+            return r, expand(r.url, vars), true
+        }
+    }
+    return rule{}, "", false
+}
+
+// resolve is lookup as a target, with the url filled in.
+func (rs *ruleSet) resolve(u *url.URL) (target, bool) {
+    r, dest, ok := rs.lookup(u)
+    if !ok {
+        return target{}, false
+    }
+    t := r.target
+    t.url = dest
+    // clicks of a pattern are counted together
+    t.path = r.path
+    if r.kind != exactRule {
+        t.serves = func(path string) bool {
+            other, _, ok := rs.lookup(&url.URL{Path: path})
+            return ok && other.index == r.index
+        }
+    }
+    return t, true
+}
+
+// routes lists the rules in file order.
+func (rs *ruleSet) routes(source string) []Route {
+    routes := make([]Route, 0, len(rs.all))
+    for _, r := range rs.all {
+        routes = append(routes, Route{Source: source, Path: r.path, Url: r.url})
+    }
+    return routes
+}
@@ -0,0 +1,216 @@
+package urlshort
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// CodeGen makes the code for a new short link to url. attempt counts up
+// from 0 each time the previous code was already taken.
+type CodeGen func(url string, attempt int) (string, error)
+
+// CounterCodes numbers links in base62, zero padded to length. The
+// counter starts at start, e.g. the number of links already stored.
+func CounterCodes(length int, start uint64) CodeGen {
+    n := start
+    return func(url string, attempt int) (string, error) {
+        code := encode62(atomic.AddUint64(&n, 1))
+        if len(code) < length {
+            code = strings.Repeat("0", length-len(code)) + code
+        }
+        return code, nil
+    }
+}
+
+// RandomCodes picks length random base62 characters.
+func RandomCodes(length int) CodeGen {
+    return func(url string, attempt int) (string, error) {
+        b := make([]byte, length)
+        max := big.NewInt(int64(len(base62)))
+        for i := range b {
+            n, err := rand.Int(rand.Reader, max)
+            if err != nil {
+                return "", err
+            }
+            b[i] = base62[n.Int64()]
+        }
+        return string(b), nil
+    }
+}
+
+// HashCodes derives the code from a hash of the url, so the same url gets
+// the same code everywhere. Collisions are resolved by hashing the
+// attempt along with the url.
+func HashCodes(length int) CodeGen {
+    return func(url string, attempt int) (string, error) {
+        sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", url, attempt)))
+        code := ""
+        // 8 bytes of hash give 10 base62 characters, use more as needed
+        for i := 0; len(code) < length && i+8 <= len(sum); i += 8 {
+            code += encode62(binary.BigEndian.Uint64(sum[i:]))
+        }
+        if len(code) > length {
+            code = code[:length]
+        }
+        return code, nil
+    }
+}
+
+// NewCodeGen returns the code generator named scheme: counter, random or
+// hash. Counters carry on from the number of links in store.
+func NewCodeGen(scheme string, length int, store Store) (CodeGen, error) {
+    if length < 1 || length > 32 {
+        return nil, fmt.Errorf("code length must be between 1 and 32")
+    }
+    switch scheme {
+    case "counter":
+        links, err := store.List()
+        if err != nil {
+            return nil, err
+        }
+        return CounterCodes(length, uint64(len(links))), nil
+    case "random":
+        return RandomCodes(length), nil
+    case "hash":
+        return HashCodes(length), nil
+    default:
+        return nil, fmt.Errorf("unknown code scheme %q. Must be counter, random or hash.", scheme)
+    }
+}
+
+func encode62(n uint64) string {
+    if n == 0 {
+        return "0"
+    }
+    var b []byte
+    for ; n > 0; n /= 62 {
+        b = append(b, base62[n%62])
+    }
+    for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+        b[i], b[j] = b[j], b[i]
+    }
+    return string(b)
+}
+
+// how many taken codes Shorten tries before giving up
+const maxAttempts = 20
+
+// Shortener creates links with generated codes.
+type Shortener struct {
+    store Store
+    gen   CodeGen
+    // held from looking up a url until its link is created, so the same
+    // url shortened twice at once still gets one code
+    mu sync.Mutex
+}
+
+func NewShortener(store Store, gen CodeGen) *Shortener {
+    return &Shortener{store: store, gen: gen}
+}
+
+// Shorten returns the link to u, creating it with a new code unless it
+// made one before. Only its own links without limits are reused, a
+// link made by hand may expire or run out of clicks. created reports
+// which one happened.
+func (s *Shortener) Shorten(u string) (link Link, created bool, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    link, err = s.store.Lookup(u)
+    if err == nil && link.plain() {
+        return link, false, nil
+    }
+    if err != nil && !errors.Is(err, ErrNotFound) {
+        return link, false, err
+    }
+    now := time.Now().UTC()
+    for attempt := 0; attempt < maxAttempts; attempt++ {
+        code, err := s.gen(u, attempt)
+        if err != nil {
+            return link, false, err
+        }
+        link = Link{Path: "/" + code, Url: u, Generated: true, Created: now, Updated: now}
+        if Reserved(link.Path) {
+            // taken by the server's own pages
+            continue
+        }
+        if err := link.Validate(); err != nil {
+            return link, false, err
+        }
+        err = s.store.Create(link)
+        if err == nil {
+            return link, true, nil
+        }
+        if !errors.Is(err, ErrExists) {
+            return link, false, err
+        }
+    }
+    return link, false, fmt.Errorf("no free code after %d attempts, try a longer code length", maxAttempts)
+}
+
+// ShortenHandler serves POST /shorten. The long url is sent as json,
+// {"url": ...}, or as a form value. The response holds the link and its
+// full short url, with status 201 for a new link and 200 for an existing
+// one.
+//
+// Unlike APIHandler it doesn't ask for a token: anyone may shorten, but
+// only generated links without limits can be made this way. Wrap it in
+// RequireToken to keep it private.
+func ShortenHandler(s *Shortener) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            w.Header().Set("Allow", http.MethodPost)
+            jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        var body struct {
+            Url string `json:"url"`
+        }
+        if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+            if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+                jsonError(w, http.StatusBadRequest, "invalid json body")
+                return
+            }
+        } else {
+            body.Url = r.FormValue("url")
+        }
+        if err := (Link{Path: "/", Url: body.Url}).Validate(); err != nil {
+            jsonError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        link, created, err := s.Shorten(body.Url)
+        if err != nil {
+            storeError(w, err)
+            return
+        }
+        status := http.StatusOK
+        if created {
+            status = http.StatusCreated
+        }
+        writeJSON(w, status, map[string]any{
+            "path":  link.Path,
+            "url":   link.Url,
+            "short": baseURL(r) + link.Path,
+        })
+    }
+}
+
+// baseURL is the scheme and host the request was made to.
+func baseURL(r *http.Request) string {
+    scheme := "http"
+    if r.TLS != nil {
+        scheme = "https"
+    }
+    return scheme + "://" + r.Host
+}
@@ -0,0 +1,209 @@
+package urlshort
+
+import (
+    "database/sql"
+    "errors"
+)
+
+// SQLStore keeps links in a "links" table of a postgres database.
+type SQLStore struct {
+    db *sql.DB
+}
+
+const createLinks = `CREATE TABLE IF NOT EXISTS links (
+    path    TEXT PRIMARY KEY,
+    url     TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+)`
+
+// columns added since the links table was first created
+var linkColumns = []string{
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS query TEXT NOT NULL DEFAULT ''`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS status INTEGER NOT NULL DEFAULT 0`,
+    // zero times for links that don't set them
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS not_before TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00'`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS expires TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00'`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS max_clicks INTEGER NOT NULL DEFAULT 0`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT ''`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS interstitial BOOLEAN NOT NULL DEFAULT false`,
+    `ALTER TABLE links ADD COLUMN IF NOT EXISTS generated BOOLEAN NOT NULL DEFAULT false`,
+}
+
+const indexLinksUrl = `CREATE INDEX IF NOT EXISTS links_url ON links (url)`
+
+const createClicks = `CREATE TABLE IF NOT EXISTS clicks (
+    path     TEXT NOT NULL,
+    at       TIMESTAMP NOT NULL,
+    referrer TEXT NOT NULL,
+    agent    TEXT NOT NULL,
+    ip       TEXT NOT NULL
+)`
+
+const indexClicksPath = `CREATE INDEX IF NOT EXISTS clicks_path ON clicks (path, at)`
+
+// the columns of a Link, in the order of fields
+const linkFields = "path, url, query, status, not_before, expires, max_clicks, owner, interstitial, generated, created, updated"
+
+// fields are the scan destinations for linkFields.
+func (l *Link) fields() []any {
+    return []any{&l.Path, &l.Url, &l.Query, &l.Status, &l.NotBefore, &l.Expires, &l.MaxClicks, &l.Owner, &l.Interstitial, &l.Generated, &l.Created, &l.Updated}
+}
+
+// NewSQLStore creates the links and clicks tables in db if they don't
+// exist yet.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+    stmts := append([]string{createLinks}, linkColumns...)
+    stmts = append(stmts, indexLinksUrl, createClicks, indexClicksPath)
+    for _, stmt := range stmts {
+        if _, err := db.Exec(stmt); err != nil {
+            return nil, err
+        }
+    }
+    return &SQLStore{db}, nil
+}
+
+func (s *SQLStore) Close() error {
+    return s.db.Close()
+}
+
+func (s *SQLStore) Get(path string) (Link, error) {
+    var l Link
+    row := s.db.QueryRow("SELECT " + linkFields + " FROM links WHERE path = $1", path)
+    err := row.Scan(l.fields()...)
+    if errors.Is(err, sql.ErrNoRows) {
+        return l, ErrNotFound
+    }
+    return l, err
+}
+
+func (s *SQLStore) Lookup(url string) (Link, error) {
+    var l Link
+    row := s.db.QueryRow("SELECT " + linkFields + " FROM links WHERE url = $1 AND generated ORDER BY created LIMIT 1", url)
+    err := row.Scan(l.fields()...)
+    if errors.Is(err, sql.ErrNoRows) {
+        return l, ErrNotFound
+    }
+    return l, err
+}
+
+func (s *SQLStore) List() ([]Link, error) {
+    rows, err := s.db.Query("SELECT " + linkFields + " FROM links ORDER BY path")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    links := make([]Link, 0)
+    for rows.Next() {
+        var l Link
+        if err := rows.Scan(l.fields()...); err != nil {
+            return nil, err
+        }
+        links = append(links, l)
+    }
+    return links, rows.Err()
+}
+
+// Create inserts l unless its path is taken. The primary key decides,
+// so of concurrent creates only one inserts and the others get
+// ErrExists rather than a constraint error.
+func (s *SQLStore) Create(l Link) error {
+    l = l.utc()
+    res, err := s.db.Exec(
+        "INSERT INTO links ("+linkFields+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) "+
+        "ON CONFLICT (path) DO NOTHING",
+        l.Path, l.Url, l.Query, l.Status, l.NotBefore, l.Expires, l.MaxClicks, l.Owner, l.Interstitial, l.Generated, l.Created, l.Updated,
+    )
+    return affected(res, err, ErrExists)
+}
+
+func (s *SQLStore) Update(l Link) error {
+    l = l.utc()
+    res, err := s.db.Exec(
+        "UPDATE links SET url = $2, query = $3, status = $4, not_before = $5, expires = $6, max_clicks = $7, owner = $8, interstitial = $9, generated = $10, updated = $11 "+
+        "WHERE path = $1",
+        l.Path, l.Url, l.Query, l.Status, l.NotBefore, l.Expires, l.MaxClicks, l.Owner, l.Interstitial, l.Generated, l.Updated,
+    )
+    return affected(res, err, ErrNotFound)
+}
+
+func (s *SQLStore) Delete(path string) error {
+    res, err := s.db.Exec("DELETE FROM links WHERE path = $1", path)
+    return affected(res, err, ErrNotFound)
+}
+
+// utc returns l with its times in UTC. The columns are TIMESTAMP, which
+// drops the offset of a time rather than converting it.
+func (l Link) utc() Link {
+    l.NotBefore, l.Expires = l.NotBefore.UTC(), l.Expires.UTC()
+    l.Created, l.Updated = l.Created.UTC(), l.Updated.UTC()
+    return l
+}
+
+// affected returns none if the statement didn't change any rows.
+func affected(res sql.Result, err error, none error) error {
+    if err != nil {
+        return err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return none
+    }
+    return nil
+}
+
+func (s *SQLStore) AddClicks(clicks []Click) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    for _, c := range clicks {
+        _, err := tx.Exec(
+            "INSERT INTO clicks (path, at, referrer, agent, ip) VALUES ($1, $2, $3, $4, $5)",
+            c.Path, c.Time.UTC(), c.Referrer, c.UserAgent, c.IP,
+        )
+        if err != nil {
+            tx.Rollback()
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+func (s *SQLStore) Clicks(path string) ([]Click, error) {
+    rows, err := s.db.Query("SELECT path, at, referrer, agent, ip FROM clicks WHERE path = $1 ORDER BY at", path)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    clicks := make([]Click, 0)
+    for rows.Next() {
+        var c Click
+        if err := rows.Scan(&c.Path, &c.Time, &c.Referrer, &c.UserAgent, &c.IP); err != nil {
+            return nil, err
+        }
+        clicks = append(clicks, c)
+    }
+    return clicks, rows.Err()
+}
+
+func (s *SQLStore) ClickCounts() (map[string]int, error) {
+    rows, err := s.db.Query("SELECT path, COUNT(*) FROM clicks GROUP BY path")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    counts := make(map[string]int)
+    for rows.Next() {
+        var path string
+        var n int
+        if err := rows.Scan(&path, &n); err != nil {
+            return nil, err
+        }
+        counts[path] = n
+    }
+    return counts, rows.Err()
+}
@@ -0,0 +1,165 @@
+package urlshort
+
+import (
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const maxBuckets = 1000
+
+// bucket sizes for GET /stats/<path>
+var bucketSizes = map[string]time.Duration{
+    "hour": time.Hour,
+    "day":  24 * time.Hour,
+    "week": 7 * 24 * time.Hour,
+}
+
+// StatsHandler serves the click statistics in clicks:
+//
+//     GET /stats?top=10                 the most clicked paths
+//     GET /stats/<path>?bucket=day&n=30 totals of one path and its clicks
+//                                       per hour, day or week for the
+//                                       last n of them
+//
+// Of the options only WithClock is used, for the end of the last bucket.
+func StatsHandler(clicks ClickStore, opts ...Option) http.HandlerFunc {
+    c := newHandlerConfig(opts)
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            w.Header().Set("Allow", http.MethodGet)
+            jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        path := strings.TrimPrefix(r.URL.Path, "/stats")
+        if path == "" || path == "/" {
+            topStats(w, r, clicks)
+            return
+        }
+        pathStats(w, r, clicks, path, c.now())
+    }
+}
+
+type pathCount struct {
+    Path   string `json:"path"`
+    Clicks int    `json:"clicks"`
+}
+
+func topStats(w http.ResponseWriter, r *http.Request, clicks ClickStore) {
+    n, ok := intParam(r, "top", 10)
+    if !ok {
+        jsonError(w, http.StatusBadRequest, "top must be a positive number")
+        return
+    }
+    counts, err := clicks.ClickCounts()
+    if err != nil {
+        storeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"top": topN(counts, n)})
+}
+
+// topN returns the n biggest counts, ties in path order.
+func topN(counts map[string]int, n int) []pathCount {
+    top := make([]pathCount, 0, len(counts))
+    for path, c := range counts {
+        top = append(top, pathCount{path, c})
+    }
+    sort.Slice(top, func(i, j int) bool {
+        if top[i].Clicks != top[j].Clicks {
+            return top[i].Clicks > top[j].Clicks
+        }
+        return top[i].Path < top[j].Path
+    })
+    if len(top) > n {
+        top = top[:n]
+    }
+    return top
+}
+
+type bucketCount struct {
+    Start  time.Time `json:"start"`
+    Clicks int       `json:"clicks"`
+}
+
+func pathStats(w http.ResponseWriter, r *http.Request, clicks ClickStore, path string, now time.Time) {
+    bucket := r.URL.Query().Get("bucket")
+    if bucket == "" {
+        bucket = "day"
+    }
+    size, ok := bucketSizes[bucket]
+    if !ok {
+        jsonError(w, http.StatusBadRequest, "bucket must be hour, day or week")
+        return
+    }
+    n, ok := intParam(r, "n", 30)
+    if !ok || n > maxBuckets {
+        jsonError(w, http.StatusBadRequest, "n must be a number from 1 to "+strconv.Itoa(maxBuckets))
+        return
+    }
+    cs, err := clicks.Clicks(path)
+    if err != nil {
+        storeError(w, err)
+        return
+    }
+    stats := map[string]any{
+        "path":      path,
+        "total":     len(cs),
+        "bucket":    bucket,
+        "counts":    buckets(cs, size, n, now.UTC()),
+        "referrers": topReferrers(cs, 5),
+    }
+    if len(cs) > 0 {
+        stats["first"] = cs[0].Time
+        stats["last"] = cs[len(cs)-1].Time
+    }
+    writeJSON(w, http.StatusOK, stats)
+}
+
+// buckets counts the clicks in each of the last n buckets of size up to
+// now, oldest first. Empty buckets are included so gaps show.
+func buckets(clicks []Click, size time.Duration, n int, now time.Time) []bucketCount {
+    end := now.Truncate(size).Add(size)
+    start := end.Add(-time.Duration(n) * size)
+    counts := make([]bucketCount, n)
+    for i := range counts {
+        counts[i].Start = start.Add(time.Duration(i) * size)
+    }
+    for _, c := range clicks {
+        if c.Time.Before(start) || !c.Time.Before(end) {
+            continue
+        }
+        counts[int(c.Time.Sub(start)/size)].Clicks++
+    }
+    return counts
+}
+
+// topReferrers returns the n most common referrers of clicks.
+func topReferrers(clicks []Click, n int) []map[string]any {
+    counts := make(map[string]int)
+    for _, c := range clicks {
+        if c.Referrer != "" {
+            counts[c.Referrer]++
+        }
+    }
+    top := make([]map[string]any, 0, n)
+    for _, pc := range topN(counts, n) {
+        top = append(top, map[string]any{"referrer": pc.Path, "clicks": pc.Clicks})
+    }
+    return top
+}
+
+// intParam reads a positive integer query parameter, def if it's unset.
+func intParam(r *http.Request, name string, def int) (int, bool) {
+    s := r.URL.Query().Get(name)
+    if s == "" {
+        return def, true
+    }
+    n, err := strconv.Atoi(s)
+    if err != nil || n < 1 {
+        return 0, false
+    }
+    return n, true
+}
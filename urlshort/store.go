@@ -0,0 +1,215 @@
+package urlshort
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    ErrNotFound = errors.New("short path not found")
+    ErrExists   = errors.New("short path already exists")
+)
+
+// Link is a short path and the url it redirects to.
+type Link struct {
+    Path    string    `json:"path"`
+    Url     string    `json:"url"`
+    // what happens to the query string of requests, see QueryPolicy
+    Query   QueryPolicy `json:"query,omitempty"`
+    // redirect status, 302 if 0, and when the link works, see PathToUrl
+    Status    int       `json:"status,omitempty"`
+    NotBefore time.Time `json:"notBefore"`
+    Expires   time.Time `json:"expires"`
+    MaxClicks int       `json:"maxClicks,omitempty"`
+    Owner        string `json:"owner,omitempty"`
+    Interstitial bool   `json:"interstitial,omitempty"`
+    // made by Shortener, which hands it out again for the same url
+    Generated bool `json:"generated,omitempty"`
+    Created time.Time `json:"created"`
+    Updated time.Time `json:"updated"`
+}
+
+// Store holds the links of a shortener. Implementations are safe for
+// concurrent use. Get, Update and Delete return ErrNotFound for unknown
+// paths and Create returns ErrExists for taken ones. Lookup finds a
+// generated link (see Link.Generated) to url, ErrNotFound if there's
+// none.
+type Store interface {
+    Get(path string) (Link, error)
+    Lookup(url string) (Link, error)
+    List() ([]Link, error)
+    Create(link Link) error
+    Update(link Link) error
+    Delete(path string) error
+}
+
+// the pages of the server itself, see Reserved
+var reservedPaths = []string{"/api", "/shorten", "/stats", "/qr"}
+
+// Reserved reports whether path belongs to the shortener's own pages
+// (the api, /shorten, /stats and /qr) rather than to a short link. The
+// server answers these before looking for redirects, so links can't
+// take them over.
+func Reserved(path string) bool {
+    for _, p := range reservedPaths {
+        if path == p || strings.HasPrefix(path, p+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// Validate checks that the link has an absolute path that isn't
+// reserved, redirects to an absolute http(s) url and has sensible
+// settings.
+func (l Link) Validate() error {
+    if !strings.HasPrefix(l.Path, "/") {
+        return fmt.Errorf("path %q must start with /", l.Path)
+    }
+    if Reserved(l.Path) {
+        return fmt.Errorf("path %q is reserved for the shortener's own pages", l.Path)
+    }
+    if _, err := validateURL(l.Url); err != nil {
+        return err
+    }
+    if err := l.Query.Validate(); err != nil {
+        return err
+    }
+    return validateLimits(l.Status, l.NotBefore, l.Expires, l.MaxClicks)
+}
+
+// plain reports whether l redirects with the defaults, any time and any
+// number of times.
+func (l Link) plain() bool {
+    return l.Query == "" && l.Status == 0 && l.NotBefore.IsZero() && l.Expires.IsZero() &&
+        l.MaxClicks == 0 && !l.Interstitial
+}
+
+func (l Link) target() target {
+    return target{
+        path:         l.Path,
+        url:          l.Url,
+        query:        l.Query,
+        status:       l.Status,
+        notBefore:    l.NotBefore,
+        expires:      l.Expires,
+        maxClicks:    l.MaxClicks,
+        owner:        l.Owner,
+        created:      l.Created,
+        interstitial: l.Interstitial,
+    }
+}
+
+// MemoryStore keeps links in a map, they're lost when the process exits.
+type MemoryStore struct {
+    mu     sync.RWMutex
+    links  map[string]Link
+    clicks map[string][]Click
+}
+
+// NewMemoryStore returns a store holding pathsToUrls.
+func NewMemoryStore(pathsToUrls map[string]string) *MemoryStore {
+    s := &MemoryStore{
+        links:  make(map[string]Link, len(pathsToUrls)),
+        clicks: make(map[string][]Click),
+    }
+    now := time.Now()
+    for path, u := range pathsToUrls {
+        s.links[path] = Link{Path: path, Url: u, Created: now, Updated: now}
+    }
+    return s
+}
+
+func (s *MemoryStore) Get(path string) (Link, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    l, ok := s.links[path]
+    if !ok {
+        return Link{}, ErrNotFound
+    }
+    return l, nil
+}
+
+func (s *MemoryStore) Lookup(url string) (Link, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    for _, l := range s.links {
+        if l.Url == url && l.Generated {
+            return l, nil
+        }
+    }
+    return Link{}, ErrNotFound
+}
+
+// List returns the links sorted by path.
+func (s *MemoryStore) List() ([]Link, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    links := make([]Link, 0, len(s.links))
+    for _, l := range s.links {
+        links = append(links, l)
+    }
+    sort.Slice(links, func(i, j int) bool {
+        return links[i].Path < links[j].Path
+    })
+    return links, nil
+}
+
+func (s *MemoryStore) Create(l Link) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.links[l.Path]; ok {
+        return ErrExists
+    }
+    s.links[l.Path] = l
+    return nil
+}
+
+func (s *MemoryStore) Update(l Link) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.links[l.Path]; !ok {
+        return ErrNotFound
+    }
+    s.links[l.Path] = l
+    return nil
+}
+
+func (s *MemoryStore) Delete(path string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.links[path]; !ok {
+        return ErrNotFound
+    }
+    delete(s.links, path)
+    return nil
+}
+
+func (s *MemoryStore) AddClicks(clicks []Click) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, c := range clicks {
+        s.clicks[c.Path] = append(s.clicks[c.Path], c)
+    }
+    return nil
+}
+
+func (s *MemoryStore) Clicks(path string) ([]Click, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return append([]Click(nil), s.clicks[path]...), nil
+}
+
+func (s *MemoryStore) ClickCounts() (map[string]int, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    counts := make(map[string]int, len(s.clicks))
+    for path, cs := range s.clicks {
+        counts[path] = len(cs)
+    }
+    return counts, nil
+}
@@ -0,0 +1,113 @@
+package urlshort
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+)
+
+// EntryError is a problem with one entry of a redirect file.
+type EntryError struct {
+    Index int // position in the file, from 0
+    Path  string
+    Err   error
+}
+
+func (e EntryError) Error() string {
+    return fmt.Sprintf("entry %d (%s): %s", e.Index, e.Path, e.Err)
+}
+
+func (e EntryError) Unwrap() error {
+    return e.Err
+}
+
+// ValidationError has every problem found in a redirect file, so they
+// can all be fixed at once instead of one per reload.
+type ValidationError []EntryError
+
+func (e ValidationError) Error() string {
+    if len(e) == 1 {
+        return e[0].Error()
+    }
+    lines := []string{fmt.Sprintf("%d invalid entries:", len(e))}
+    for _, err := range e {
+        lines = append(lines, "    "+err.Error())
+    }
+    return strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) add(index int, path string, err error) {
+    *e = append(*e, EntryError{Index: index, Path: path, Err: err})
+}
+
+// WithHosts names the hosts the shortener is reached on, e.g.
+// "sho.rt" or "localhost:8080". Redirects to them are checked for loops.
+func WithHosts(hosts ...string) Option {
+    return func(c *handlerConfig) { c.hosts = append(c.hosts, hosts...) }
+}
+
+// validateURL checks that s is an absolute http(s) url.
+func validateURL(s string) (*url.URL, error) {
+    u, err := url.Parse(s)
+    if err != nil {
+        return nil, fmt.Errorf("invalid url %q", s)
+    }
+    if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+        return nil, fmt.Errorf("url %q must be an absolute http or https url", s)
+    }
+    return u, nil
+}
+
+// loops finds rules that redirect back into the shortener and, following
+// the redirects, end up where they started. Only urls without
+// placeholders are followed, the rest depend on the request.
+func (rs *ruleSet) loops(hosts []string) ValidationError {
+    if len(hosts) == 0 {
+        return nil
+    }
+    own := make(map[string]bool)
+    for _, h := range hosts {
+        own[strings.ToLower(h)] = true
+    }
+    // next is the rule a rule's url leads to, if it leads back in
+    next := func(r rule) (rule, bool) {
+        if placeholder.MatchString(r.url) {
+            return rule{}, false
+        }
+        u, err := url.Parse(r.url)
+        if err != nil || !own[strings.ToLower(u.Host)] {
+            return rule{}, false
+        }
+        n, _, ok := rs.lookup(u)
+        return n, ok
+    }
+    var errs ValidationError
+    check := func(r rule) {
+        chain := []string{r.path}
+        seen := map[int]bool{r.index: true}
+        for cur := r; ; {
+            n, ok := next(cur)
+            if !ok {
+                return
+            }
+            chain = append(chain, n.path)
+            if n.index == r.index {
+                errs.add(r.index, r.path, fmt.Errorf("redirect loop %s", strings.Join(chain, " -> ")))
+                return
+            }
+            if seen[n.index] {
+                // a loop that doesn't go through r, reported for its own rules
+                return
+            }
+            seen[n.index] = true
+            cur = n
+        }
+    }
+    for _, r := range rs.exact {
+        check(r)
+    }
+    for _, r := range rs.patterns {
+        check(r)
+    }
+    return errs
+}